@@ -1,13 +1,22 @@
 package main
 
 import (
+	"context"
 	"log"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
 	"time"
 
 	"decodeBot/internal/bot"
 	"decodeBot/internal/client"
 	"decodeBot/internal/config"
+	"decodeBot/internal/experiments"
+	"decodeBot/internal/outbox"
+	"decodeBot/internal/reminders"
 	"decodeBot/internal/scheduler"
+	"decodeBot/internal/sender"
 	"decodeBot/internal/webhook"
 
 	"github.com/joho/godotenv"
@@ -23,6 +32,23 @@ func main() {
 	// Load configuration
 	cfg := config.Load()
 
+	// Load reminder templates and the experiments on them; a broken file is a deployment
+	// mistake, so don't start with it
+	exps, err := experiments.Load(cfg.ExperimentsFile)
+	if err != nil {
+		log.Fatalf("❌ Experiments: %v", err)
+	}
+	templates, err := reminders.Open(cfg.ReminderTemplatesDir, reminders.Options{Experiments: exps})
+	if err != nil {
+		log.Fatalf("❌ Reminder templates: %v", err)
+	}
+	if cfg.ReminderTemplatesDir != "" {
+		log.Printf("✓ Reminder templates loaded from %s", cfg.ReminderTemplatesDir)
+	}
+	for _, e := range exps.All() {
+		log.Printf("🧪 Experiment %s running on %s reminders with %d arms", e.Name, e.Kind, len(e.Arms))
+	}
+
 	// Initialize server client
 	serverClient := client.NewServerClient(cfg.ServerURL, cfg.BotSecret)
 
@@ -56,7 +82,7 @@ func main() {
 	// Initialize bot
 	pref := tele.Settings{
 		Token:  cfg.BotToken,
-		Poller: &tele.LongPoller{Timeout: 10 * time.Second},
+		Poller: newPoller(cfg),
 	}
 
 	b, err := tele.NewBot(pref)
@@ -70,8 +96,15 @@ func main() {
 
 	log.Printf("✓ Bot authorized as @%s", b.Me.Username)
 
+	if cfg.UpdateMode == config.UpdateModePolling {
+		// getUpdates is rejected while a webhook is registered, e.g. after running in webhook mode
+		if err := b.RemoveWebhook(); err != nil {
+			log.Printf("⚠️  Failed to remove webhook: %v", err)
+		}
+	}
+
 	// Initialize handler
-	handler := bot.NewHandler(b, serverClient)
+	handler := bot.NewHandler(b, serverClient, templates, cfg)
 
 	// Register command handlers
 	b.Use(func(next tele.HandlerFunc) tele.HandlerFunc {
@@ -82,6 +115,11 @@ func main() {
 	})
 
 	b.Handle("/start", handler.HandleStart)
+	b.Handle("/stats", handler.HandleStats)
+	b.Handle("/invite", handler.HandleInvite)
+	b.Handle("/timezone", handler.HandleTimezone)
+	b.Handle("/language", handler.HandleLanguage)
+	b.Handle(&tele.Btn{Unique: bot.LanguageCallback}, handler.HandleLanguageSelected)
 	// Admin middleware
 	adminOnly := func(next tele.HandlerFunc) tele.HandlerFunc {
 		return func(c tele.Context) error {
@@ -98,13 +136,36 @@ func main() {
 	b.Handle("/test_streak", handler.HandleTestStreak, adminOnly)
 	b.Handle("/debug_schedule", handler.HandleDebugSchedule, adminOnly)
 
+	// Shared rate-limited sender so all outgoing messages respect Telegram limits
+	msgSender := sender.New(b, sender.Options{
+		GlobalRate:  cfg.SendRateGlobal,
+		PerChatRate: cfg.SendRatePerChat,
+	})
+
+	// Journal outgoing messages so nothing accepted is lost to a crash or restart
+	msgOutbox, err := outbox.Open(cfg.OutboxPath, msgSender, outbox.Options{
+		QueueSize: cfg.OutboxQueueSize,
+		Workers:   cfg.OutboxWorkers,
+	})
+	if err != nil {
+		log.Fatalf("❌ Outbox: %v", err)
+	}
+	log.Printf("✓ Outbox journal at %s", cfg.OutboxPath)
+
 	// Initialize and start scheduler for daily notifications
-	sched := scheduler.NewScheduler(b, serverClient)
+	sched := scheduler.NewScheduler(msgOutbox, serverClient, templates, cfg)
 	sched.Start()
 
 	// Initialize and start webhook server for backend notifications
-	webhookServer := webhook.NewServer(b, cfg.WebhookPort)
-	webhookServer.Start()
+	webhookServer := webhook.NewServer(msgOutbox, cfg)
+	if cfg.UpdateMode == config.UpdateModeWebhook && cfg.TelegramWebhookListen == "" {
+		// Telegram pushes updates to the same listener as the backend webhooks
+		webhookServer.Handle(cfg.TelegramWebhookPath, webhook.TelegramHandler(b.Updates, cfg.TelegramWebhookSecret))
+		log.Printf("✓ Telegram updates accepted on %s", cfg.TelegramWebhookPath)
+	}
+	if err := webhookServer.Start(); err != nil {
+		log.Fatalf("❌ Webhook server: %v", err)
+	}
 	log.Printf("✓ Webhook server started on port %s", cfg.WebhookPort)
 
 	// Send startup notification to admin only if server is ready
@@ -117,6 +178,97 @@ func main() {
 	log.Println("🤖 Bot is running...")
 	log.Println("Press Ctrl+C to stop")
 
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// Pick up edited reminder templates without a restart, on SIGHUP or when the files change
+	go templates.Watch(ctx, cfg.ReminderTemplatesPoll)
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			if err := templates.Reload(); err != nil {
+				log.Printf("⚠️  Reminder templates not reloaded, keeping the previous ones: %v", err)
+				continue
+			}
+			log.Println("✓ Reminder templates reloaded")
+		}
+	}()
+
 	// Start bot
-	b.Start()
+	go b.Start()
+
+	<-ctx.Done()
+	log.Println("🛑 Shutdown signal received, draining...")
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+
+	// The long poller may sit in getUpdates for its full timeout, so stop it alongside the rest
+	pollerStopped := make(chan struct{})
+	go func() {
+		b.Stop()
+		close(pollerStopped)
+	}()
+
+	// Drain both in parallel so a slow one doesn't eat the other's budget
+	var drained sync.WaitGroup
+	drained.Add(2)
+	go func() {
+		defer drained.Done()
+		if err := webhookServer.Shutdown(shutdownCtx); err != nil {
+			log.Printf("⚠️  Webhook server shutdown: %v", err)
+		}
+	}()
+	go func() {
+		defer drained.Done()
+		if err := sched.Stop(shutdownCtx); err != nil {
+			log.Printf("⚠️  Scheduler shutdown: %v", err)
+		}
+	}()
+	drained.Wait()
+
+	// Both feed the outbox, so it goes last; whatever it can't send stays journaled for the next start
+	if err := msgOutbox.Close(shutdownCtx); err != nil {
+		log.Printf("⚠️  Outbox shutdown: %v", err)
+	}
+
+	select {
+	case <-pollerStopped:
+	case <-shutdownCtx.Done():
+		log.Println("⚠️  Poller didn't stop before the deadline")
+	}
+
+	log.Println("👋 Bot stopped")
+}
+
+// newPoller returns the update source for the configured delivery mode
+func newPoller(cfg *config.Config) tele.Poller {
+	if cfg.UpdateMode != config.UpdateModeWebhook {
+		log.Println("📡 Receiving updates via long polling")
+		return &tele.LongPoller{Timeout: 10 * time.Second}
+	}
+
+	hook := &tele.Webhook{
+		SecretToken: cfg.TelegramWebhookSecret,
+		Endpoint: &tele.WebhookEndpoint{
+			PublicURL: cfg.TelegramWebhookURL,
+			Cert:      cfg.TelegramWebhookCert,
+		},
+	}
+
+	// With a dedicated listener telebot serves the updates itself; otherwise the
+	// hook only registers the URL and the shared webhook server handles requests
+	if cfg.TelegramWebhookListen != "" {
+		hook.Listen = cfg.TelegramWebhookListen
+		if cfg.TelegramWebhookCert != "" && cfg.TelegramWebhookKey != "" {
+			hook.TLS = &tele.WebhookTLS{
+				Cert: cfg.TelegramWebhookCert,
+				Key:  cfg.TelegramWebhookKey,
+			}
+		}
+	}
+
+	log.Printf("📡 Receiving updates via webhook at %s", cfg.TelegramWebhookURL)
+	return hook
 }
@@ -0,0 +1,118 @@
+package bot
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	tele "gopkg.in/telebot.v4"
+)
+
+// ParseMode is the Telegram parse mode of every message template in this package.
+// Send template output with it, e.g. c.Send(GetWelcomeMessage(name), ParseMode).
+const ParseMode = tele.ModeHTML
+
+var (
+	htmlEscaper = strings.NewReplacer(
+		"&", "&amp;",
+		"<", "&lt;",
+		">", "&gt;",
+		`"`, "&quot;",
+	)
+
+	markdownV2Escaper = strings.NewReplacer(
+		`\`, `\\`,
+		"_", `\_`, "*", `\*`, "[", `\[`, "]", `\]`, "(", `\(`, ")", `\)`,
+		"~", `\~`, "`", "\\`", ">", `\>`, "#", `\#`, "+", `\+`, "-", `\-`,
+		"=", `\=`, "|", `\|`, "{", `\{`, "}", `\}`, ".", `\.`, "!", `\!`,
+	)
+)
+
+// EscapeHTML makes text safe to embed in a message sent with tele.ModeHTML
+func EscapeHTML(s string) string {
+	return htmlEscaper.Replace(s)
+}
+
+// EscapeMarkdownV2 makes text safe to embed in a message sent with tele.ModeMarkdownV2
+func EscapeMarkdownV2(s string) string {
+	return markdownV2Escaper.Replace(s)
+}
+
+// Safe is text already formatted for the target parse mode, e.g. the output of an
+// earlier Sprintf. Formatters insert it as is instead of escaping it.
+type Safe string
+
+// Formatter renders message templates for one parse mode
+type Formatter struct {
+	mode   tele.ParseMode
+	escape func(string) string
+}
+
+// Formatters for the parse modes Telegram supports
+var (
+	HTML       = Formatter{mode: tele.ModeHTML, escape: EscapeHTML}
+	MarkdownV2 = Formatter{mode: tele.ModeMarkdownV2, escape: EscapeMarkdownV2}
+)
+
+// Mode returns the parse mode to send the formatted text with
+func (f Formatter) Mode() tele.ParseMode {
+	return f.mode
+}
+
+// Sprintf formats like fmt.Sprintf, but escapes every argument that isn't Safe.
+// The template itself is trusted markup and must already be valid for the mode.
+func (f Formatter) Sprintf(template string, args ...interface{}) string {
+	escaped := make([]interface{}, len(args))
+	for i, arg := range args {
+		if safe, ok := arg.(Safe); ok {
+			escaped[i] = string(safe)
+			continue
+		}
+		escaped[i] = escapedArg{value: arg, escape: f.escape}
+	}
+	return fmt.Sprintf(template, escaped...)
+}
+
+// escapedArg formats a value with the verb it was given and escapes the result,
+// so numbers with flags like %02d keep working
+type escapedArg struct {
+	value  interface{}
+	escape func(string) string
+}
+
+func (a escapedArg) Format(s fmt.State, verb rune) {
+	io.WriteString(s, a.escape(fmt.Sprintf(fmt.FormatString(s, verb), a.value)))
+}
+
+// Builder assembles a message from pieces; only template text is left unescaped
+type Builder struct {
+	f  Formatter
+	sb strings.Builder
+}
+
+// NewBuilder starts an empty message for the formatter's parse mode
+func (f Formatter) NewBuilder() *Builder {
+	return &Builder{f: f}
+}
+
+// Printf appends a template, escaping its arguments (see Formatter.Sprintf)
+func (b *Builder) Printf(template string, args ...interface{}) *Builder {
+	b.sb.WriteString(b.f.Sprintf(template, args...))
+	return b
+}
+
+// Text appends escaped plain text
+func (b *Builder) Text(s string) *Builder {
+	b.sb.WriteString(b.f.escape(s))
+	return b
+}
+
+// String returns the formatted message
+func (b *Builder) String() string {
+	return b.sb.String()
+}
+
+// Safe returns the formatted message for embedding in another template
+func (b *Builder) Safe() Safe {
+	return Safe(b.sb.String())
+}
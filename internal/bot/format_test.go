@@ -0,0 +1,128 @@
+package bot
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+
+	"decodeBot/internal/i18n"
+	"decodeBot/internal/models"
+	"decodeBot/internal/reminders"
+)
+
+// hostileNames are first names that break or inject formatting when sent raw
+var hostileNames = []struct {
+	name     string
+	html     string
+	markdown string
+}{
+	{"snake_case_", "snake_case_", `snake\_case\_`},
+	{"*bold*", "*bold*", `\*bold\*`},
+	{"[click](https://evil.example)", "[click](https://evil.example)", `\[click\]\(https://evil\.example\)`},
+	{"<b>Neo</b>", "&lt;b&gt;Neo&lt;/b&gt;", `<b\>Neo</b\>`},
+	{`<a href="https://evil.example">x</a>`, "&lt;a href=&quot;https://evil.example&quot;&gt;x&lt;/a&gt;", `<a href\="https://evil\.example"\>x</a\>`},
+	{"Tom & Jerry", "Tom &amp; Jerry", "Tom & Jerry"},
+	{"`code` ~strike~ ||spoiler||", "`code` ~strike~ ||spoiler||", "\\`code\\` \\~strike\\~ \\|\\|spoiler\\|\\|"},
+	{`back\slash`, `back\slash`, `back\\slash`},
+	{"Mr. T-1000 #1 +{x}=!", "Mr. T-1000 #1 +{x}=!", `Mr\. T\-1000 \#1 \+\{x\}\=\!`},
+	{"&lt;already escaped&gt;", "&amp;lt;already escaped&amp;gt;", "&lt;already escaped&gt;"},
+}
+
+func TestEscapeHTML(t *testing.T) {
+	for _, tt := range hostileNames {
+		if got := EscapeHTML(tt.name); got != tt.html {
+			t.Errorf("EscapeHTML(%q): expected %q, got %q", tt.name, tt.html, got)
+		}
+	}
+}
+
+func TestEscapeMarkdownV2(t *testing.T) {
+	for _, tt := range hostileNames {
+		if got := EscapeMarkdownV2(tt.name); got != tt.markdown {
+			t.Errorf("EscapeMarkdownV2(%q): expected %q, got %q", tt.name, tt.markdown, got)
+		}
+	}
+}
+
+func TestSprintfEscapesArguments(t *testing.T) {
+	tests := []struct {
+		name string
+		got  string
+		want string
+	}{
+		{"string", HTML.Sprintf("<b>%s</b>", "<i>x</i>"), "<b>&lt;i&gt;x&lt;/i&gt;</b>"},
+		{"indexed", HTML.Sprintf("%[2]s/%[1]s", "a&b", "c<d"), "c&lt;d/a&amp;b"},
+		{"number flags", HTML.Sprintf("%02d:00", 7), "07:00"},
+		{"safe", HTML.Sprintf("%s %s", Safe("<b>ok</b>"), "<b>no</b>"), "<b>ok</b> &lt;b&gt;no&lt;/b&gt;"},
+		{"markdown", MarkdownV2.Sprintf("*%s* %d", "a_b", -1), `*a\_b* \-1`},
+		{"builder", HTML.NewBuilder().Printf("<b>%s</b>", "1<2").Text(" & more").String(), "<b>1&lt;2</b> &amp; more"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.got != tt.want {
+				t.Errorf("Expected %q, got %q", tt.want, tt.got)
+			}
+		})
+	}
+}
+
+// htmlTag matches anything Telegram would parse as an HTML tag
+var htmlTag = regexp.MustCompile(`<[^>]*>`)
+
+func TestTemplatesEscapeHostileNames(t *testing.T) {
+	store, err := reminders.Open("", reminders.Options{})
+	if err != nil {
+		t.Fatalf("Failed to load reminder templates: %v", err)
+	}
+
+	templates := []struct {
+		name   string
+		render func(name string) string
+	}{
+		{"welcome", func(name string) string { return GetWelcomeMessage(i18n.Default(), name) }},
+		{"reminder with streak", func(name string) string {
+			message, _ := GetDailyReminderMessage(store, i18n.Default(), 42, name, 5)
+			return message
+		}},
+		{"reminder without streak", func(name string) string {
+			message, _ := GetDailyReminderMessage(store, i18n.Resolve("ru"), 42, name, 0)
+			return message
+		}},
+		{"russian referral", func(name string) string { return GetReferralMessage(i18n.Resolve("ru"), name) }},
+		{"polish stats", func(name string) string {
+			return GetStreakStatsMessage(i18n.Resolve("pl"), &models.UserProfile{FirstName: name})
+		}},
+		{"invalid timezone", func(name string) string { return GetTimezoneInvalidMessage(i18n.Default(), name) }},
+		{"achievement", func(name string) string { return GetAchievementMessage(i18n.Default(), name, name, RarityEpic, 10) }},
+		{"streak at risk", func(name string) string {
+			return GetStreakAtRiskMessage(i18n.Resolve("ru"), &models.User{FirstName: name, HexStreak: 3}, VariantHex, 2)
+		}},
+		{"streak broken", func(name string) string {
+			return GetStreakBrokenMessage(i18n.Default(), &models.User{FirstName: name}, VariantWord, 4)
+		}},
+		{"overtaken summary", func(name string) string {
+			return GetOvertakenSummaryMessage(i18n.Resolve("pl"), name, []Overtake{
+				{RivalName: name, Board: BoardDaily, OldRank: 1, NewRank: 2},
+				{RivalName: "Smith", Board: BoardDaily, OldRank: 2, NewRank: 3},
+			})
+		}},
+	}
+
+	for _, tmpl := range templates {
+		for _, hostile := range hostileNames {
+			t.Run(tmpl.name+"/"+hostile.name, func(t *testing.T) {
+				message := tmpl.render(hostile.name)
+
+				if !strings.Contains(message, hostile.html) {
+					t.Errorf("Expected escaped name %q in message, got:\n%s", hostile.html, message)
+				}
+				for _, tag := range htmlTag.FindAllString(message, -1) {
+					if tag != "<b>" && tag != "</b>" {
+						t.Errorf("Unexpected markup %q in message:\n%s", tag, message)
+					}
+				}
+			})
+		}
+	}
+}
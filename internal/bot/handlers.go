@@ -1,24 +1,43 @@
 package bot
 
 import (
+	"errors"
 	"fmt"
 	"log"
+	"net/url"
+	"sync"
 
 	"decodeBot/internal/client"
+	"decodeBot/internal/config"
+	"decodeBot/internal/i18n"
 	"decodeBot/internal/models"
+	"decodeBot/internal/referral"
+	"decodeBot/internal/reminders"
+	"decodeBot/internal/timezone"
 
 	tele "gopkg.in/telebot.v4"
 )
 
+// LanguageCallback is the unique ID of the /language keyboard buttons
+const LanguageCallback = "language"
+
 type Handler struct {
-	bot    *tele.Bot
-	client *client.ServerClient
+	bot       *tele.Bot
+	client    *client.ServerClient
+	cfg       *config.Config
+	templates *reminders.Store
+
+	// languages caches each user's chosen language (telegram ID -> code),
+	// so replies follow /language without asking the server every time
+	languages sync.Map
 }
 
-func NewHandler(bot *tele.Bot, serverClient *client.ServerClient) *Handler {
+func NewHandler(bot *tele.Bot, serverClient *client.ServerClient, templates *reminders.Store, cfg *config.Config) *Handler {
 	return &Handler{
-		bot:    bot,
-		client: serverClient,
+		bot:       bot,
+		client:    serverClient,
+		cfg:       cfg,
+		templates: templates,
 	}
 }
 
@@ -29,11 +48,15 @@ func (h *Handler) HandleStart(c tele.Context) error {
 	log.Printf("[USER:%d] Command: /start (@%s)", user.ID, user.Username)
 
 	// Register or update user in database
+	// Timezone and language are only hints from Telegram; the server keeps an explicit
+	// /timezone or /language choice
 	userData := &models.User{
-		TelegramID: user.ID,
-		Username:   user.Username,
-		FirstName:  user.FirstName,
-		LastName:   user.LastName,
+		TelegramID:   user.ID,
+		Username:     user.Username,
+		FirstName:    user.FirstName,
+		LastName:     user.LastName,
+		Timezone:     timezone.GuessFromLanguage(user.LanguageCode),
+		LanguageCode: user.LanguageCode,
 	}
 
 	if err := h.client.RegisterUser(userData); err != nil {
@@ -42,28 +65,185 @@ func (h *Handler) HandleStart(c tele.Context) error {
 	}
 
 	// Check for referral parameter
-	// Format: /start ref_123456789
+	// Format: /start rs_<signed token> or legacy /start ref_123456789
 	args := c.Args()
-	if len(args) > 0 && len(args[0]) > 4 && args[0][:4] == "ref_" {
-		referrerID := int64(0)
-		fmt.Sscanf(args[0], "ref_%d", &referrerID)
-
-		if referrerID > 0 && referrerID != user.ID {
-			log.Printf("[REFERRAL] User %d referred by %d", user.ID, referrerID)
-			resp, err := h.client.ProcessReferral(referrerID, user.ID)
-			if err != nil {
-				log.Printf("[ERROR] Failed to process referral: %v", err)
-			} else if resp.Success {
-				log.Printf("[REFERRAL] Success: %s", resp.Message)
-			}
-		}
+	if len(args) > 0 {
+		h.processReferral(user, args[0])
 	}
 
 	// Send welcome message
-	message := GetWelcomeMessage(user.FirstName)
-	menu := GetMainMenu()
+	loc := h.locale(user)
+	message := GetWelcomeMessage(loc, user.FirstName)
+	menu := GetMainMenu(loc, h.cfg.MiniAppURL)
+
+	return c.Send(message, menu, ParseMode)
+}
+
+// processReferral verifies the referral start parameter and credits the referrer
+func (h *Handler) processReferral(user *tele.User, param string) {
+	referrerID, err := referral.Parse(param, h.cfg.BotSecret, h.cfg.AllowLegacyReferrals)
+	if err != nil {
+		log.Printf("[REFERRAL] Rejected start parameter %q from user %d: %v", param, user.ID, err)
+		return
+	}
+
+	if referrerID == user.ID {
+		return
+	}
+
+	log.Printf("[REFERRAL] User %d referred by %d", user.ID, referrerID)
+	resp, err := h.client.ProcessReferral(referrerID, user.ID)
+	if err != nil {
+		log.Printf("[ERROR] Failed to process referral: %v", err)
+	} else if resp.Success {
+		log.Printf("[REFERRAL] Success: %s", resp.Message)
+	}
+}
+
+// HandleStats handles the /stats command
+func (h *Handler) HandleStats(c tele.Context) error {
+	user := c.Sender()
+
+	log.Printf("[USER:%d] Command: /stats (@%s)", user.ID, user.Username)
+
+	loc := h.locale(user)
+	profile, err := h.client.GetUserProfile(user.ID)
+	if errors.Is(err, client.ErrUserNotFound) {
+		return c.Send(GetStatsUnknownUserMessage(loc), GetMainMenu(loc, h.cfg.MiniAppURL), ParseMode)
+	}
+	if err != nil {
+		log.Printf("[ERROR] Failed to get profile for user %d: %v", user.ID, err)
+		return c.Send(GetStatsUnavailableMessage(loc), ParseMode)
+	}
+
+	if profile.FirstName == "" {
+		profile.FirstName = user.FirstName
+	}
+	if profile.LanguageCode != "" {
+		h.languages.Store(user.ID, profile.LanguageCode)
+		loc = h.locale(user)
+	}
+
+	return c.Send(GetStreakStatsMessage(loc, profile), GetMainMenu(loc, h.cfg.MiniAppURL), ParseMode)
+}
+
+// HandleInvite handles the /invite command
+func (h *Handler) HandleInvite(c tele.Context) error {
+	user := c.Sender()
+
+	log.Printf("[USER:%d] Command: /invite (@%s)", user.ID, user.Username)
+
+	loc := h.locale(user)
+	link, err := h.referralLink(user.ID)
+	if err != nil {
+		log.Printf("[REFERRAL] Cannot issue a link for %d: %v", user.ID, err)
+		return c.Send(GetInviteUnavailableMessage(loc), ParseMode)
+	}
+
+	// Referral count is optional - the link works even if the server is down
+	referralCount := -1
+	profile, err := h.client.GetUserProfile(user.ID)
+	switch {
+	case err == nil:
+		referralCount = profile.ReferralCount
+	case errors.Is(err, client.ErrUserNotFound):
+		referralCount = 0
+	default:
+		log.Printf("[ERROR] Failed to get profile for user %d: %v", user.ID, err)
+	}
+
+	return c.Send(GetInviteMessage(loc, link, referralCount), GetInviteMenu(loc, link), tele.NoPreview, ParseMode)
+}
+
+// referralLink builds the personal deep link for a referrer.
+// Links are signed with BOT_SECRET. Without a secret the legacy format is only used
+// when ALLOW_LEGACY_REFERRALS is on; otherwise /start would reject the bot's own link.
+func (h *Handler) referralLink(telegramID int64) (string, error) {
+	username := h.cfg.BotUsername
+	if username == "" {
+		username = h.bot.Me.Username
+	}
+
+	param, err := referral.Sign(telegramID, h.cfg.BotSecret)
+	if err != nil {
+		if !h.cfg.AllowLegacyReferrals {
+			return "", err
+		}
+		log.Printf("[REFERRAL] Cannot sign link for %d (%v), falling back to legacy format", telegramID, err)
+		param = fmt.Sprintf("%s%d", referral.LegacyPrefix, telegramID)
+	}
+
+	return fmt.Sprintf("https://t.me/%s?start=%s", username, param), nil
+}
+
+// HandleTimezone handles the /timezone command
+// Format: /timezone Europe/Warsaw
+func (h *Handler) HandleTimezone(c tele.Context) error {
+	user := c.Sender()
+
+	log.Printf("[USER:%d] Command: /timezone (@%s)", user.ID, user.Username)
+
+	loc := h.locale(user)
+	args := c.Args()
+	if len(args) == 0 {
+		return c.Send(GetTimezoneUsageMessage(loc, timezone.GuessFromLanguage(user.LanguageCode)), ParseMode)
+	}
+
+	zone := args[0]
+	if !timezone.Valid(zone) {
+		return c.Send(GetTimezoneInvalidMessage(loc, zone), ParseMode)
+	}
+
+	if err := h.client.UpdateUserTimezone(user.ID, zone); err != nil {
+		if errors.Is(err, client.ErrUserNotFound) {
+			return c.Send(GetTimezoneUnknownUserMessage(loc), GetMainMenu(loc, h.cfg.MiniAppURL), ParseMode)
+		}
+		log.Printf("[ERROR] Failed to update timezone for user %d: %v", user.ID, err)
+		return c.Send(GetTimezoneUnavailableMessage(loc), ParseMode)
+	}
+
+	return c.Send(GetTimezoneUpdatedMessage(loc, zone, h.cfg.QuietHoursStart, h.cfg.QuietHoursEnd), ParseMode)
+}
+
+// HandleLanguage handles the /language command by offering the supported languages
+func (h *Handler) HandleLanguage(c tele.Context) error {
+	user := c.Sender()
+
+	log.Printf("[USER:%d] Command: /language (@%s)", user.ID, user.Username)
 
-	return c.Send(message, menu)
+	return c.Send(GetLanguagePromptMessage(h.locale(user)), GetLanguageMenu(), ParseMode)
+}
+
+// HandleLanguageSelected saves the language picked on the /language keyboard
+func (h *Handler) HandleLanguageSelected(c tele.Context) error {
+	user := c.Sender()
+	defer c.Respond()
+
+	loc, ok := i18n.Lookup(c.Data())
+	if !ok {
+		// Button from a keyboard sent before the language was removed
+		return c.Edit(GetLanguagePromptMessage(h.locale(user)), GetLanguageMenu(), ParseMode)
+	}
+
+	log.Printf("[USER:%d] Language: %s", user.ID, loc.Lang())
+
+	if err := h.client.UpdateUserLanguage(user.ID, loc.Lang()); err != nil {
+		if errors.Is(err, client.ErrUserNotFound) {
+			return c.Edit(GetLanguageUnknownUserMessage(loc), GetMainMenu(loc, h.cfg.MiniAppURL), ParseMode)
+		}
+		log.Printf("[ERROR] Failed to update language for user %d: %v", user.ID, err)
+		return c.Edit(GetLanguageUnavailableMessage(h.locale(user)), ParseMode)
+	}
+
+	h.languages.Store(user.ID, loc.Lang())
+	return c.Edit(GetLanguageUpdatedMessage(loc), ParseMode)
+}
+
+// locale picks the catalog for a user: their /language choice, then Telegram's language
+func (h *Handler) locale(user *tele.User) *i18n.Catalog {
+	chosen, _ := h.languages.Load(user.ID)
+	code, _ := chosen.(string)
+	return i18n.Resolve(code, user.LanguageCode)
 }
 
 // HandleTestDaily triggers a test daily reminder
@@ -71,9 +251,10 @@ func (h *Handler) HandleTestDaily(c tele.Context) error {
 	user := c.Sender()
 	// Mock streak for testing
 	streak := 0
-	message := GetDailyReminderMessage(user.FirstName, streak)
-	menu := GetMainMenu()
-	return c.Send(message, menu)
+	loc := h.locale(user)
+	message, _ := GetDailyReminderMessage(h.templates, loc, user.ID, user.FirstName, streak)
+	menu := GetMainMenu(loc, h.cfg.MiniAppURL)
+	return c.Send(message, menu, ParseMode)
 }
 
 // HandleTestStreak triggers a test streak reminder
@@ -81,9 +262,10 @@ func (h *Handler) HandleTestStreak(c tele.Context) error {
 	user := c.Sender()
 	// Mock streak for testing
 	streak := 5
-	message := GetDailyReminderMessage(user.FirstName, streak)
-	menu := GetMainMenu()
-	return c.Send(message, menu)
+	loc := h.locale(user)
+	message, _ := GetDailyReminderMessage(h.templates, loc, user.ID, user.FirstName, streak)
+	menu := GetMainMenu(loc, h.cfg.MiniAppURL)
+	return c.Send(message, menu, ParseMode)
 }
 
 // HandleDebugSchedule triggers the server to generate notification jobs
@@ -97,12 +279,12 @@ func (h *Handler) HandleDebugSchedule(c tele.Context) error {
 	return c.Send("✅ Server triggered to schedule daily notifications!")
 }
 
-// GetMainMenu returns the main inline keyboard
-func GetMainMenu() *tele.ReplyMarkup {
+// GetMainMenu returns the main inline keyboard opening the Mini App hosted at appURL
+func GetMainMenu(loc *i18n.Catalog, appURL string) *tele.ReplyMarkup {
 	menu := &tele.ReplyMarkup{}
 
-	btnPlay := menu.WebApp("🎮 Play DEC0D3 Game 🎮", &tele.WebApp{
-		URL: "https://ushpuras.dev/DEC0D3/",
+	btnPlay := menu.WebApp(loc.Text("menu.play"), &tele.WebApp{
+		URL: appURL,
 	})
 
 	menu.Inline(
@@ -111,3 +293,85 @@ func GetMainMenu() *tele.ReplyMarkup {
 
 	return menu
 }
+
+// GetLanguageMenu returns the inline keyboard with one button per supported language,
+// each labelled in its own language
+func GetLanguageMenu() *tele.ReplyMarkup {
+	menu := &tele.ReplyMarkup{}
+
+	var rows []tele.Row
+	for _, lang := range i18n.Supported() {
+		name := i18n.Resolve(lang).Text("language.name")
+		rows = append(rows, menu.Row(menu.Data(name, LanguageCallback, lang)))
+	}
+
+	menu.Inline(rows...)
+
+	return menu
+}
+
+// GetAchievementMenu returns the inline keyboard that opens the Mini App on the achievements screen,
+// highlighting the given achievement
+func GetAchievementMenu(loc *i18n.Catalog, appURL, code string) *tele.ReplyMarkup {
+	menu := &tele.ReplyMarkup{}
+
+	btnAchievements := menu.WebApp(loc.Text("menu.achievements"), &tele.WebApp{
+		URL: miniAppScreenURL(appURL, "achievements", url.Values{"achievement": {code}}),
+	})
+
+	menu.Inline(
+		menu.Row(btnAchievements),
+	)
+
+	return menu
+}
+
+// GetLeaderboardMenu returns the inline keyboard that opens the Mini App on a leaderboard
+func GetLeaderboardMenu(loc *i18n.Catalog, appURL, board, variant string) *tele.ReplyMarkup {
+	menu := &tele.ReplyMarkup{}
+
+	params := url.Values{"board": {board}}
+	if variant != "" {
+		params.Set("variant", variant)
+	}
+	btnLeaderboard := menu.WebApp(loc.Text("menu.leaderboard"), &tele.WebApp{
+		URL: miniAppScreenURL(appURL, "leaderboard", params),
+	})
+
+	menu.Inline(
+		menu.Row(btnLeaderboard),
+	)
+
+	return menu
+}
+
+// miniAppScreenURL deep links into a screen of the Mini App hosted at appURL
+func miniAppScreenURL(appURL, screen string, params url.Values) string {
+	u, err := url.Parse(appURL)
+	if err != nil {
+		return appURL
+	}
+	// Keep any query the configured URL already has
+	query := u.Query()
+	for k, v := range params {
+		query[k] = v
+	}
+	query.Set("screen", screen)
+	u.RawQuery = query.Encode()
+	return u.String()
+}
+
+// GetInviteMenu returns the inline keyboard with a Telegram share button for the referral link
+func GetInviteMenu(loc *i18n.Catalog, link string) *tele.ReplyMarkup {
+	menu := &tele.ReplyMarkup{}
+
+	shareURL := "https://t.me/share/url?url=" + url.QueryEscape(link) +
+		"&text=" + url.QueryEscape(GetInviteShareText(loc))
+	btnShare := menu.URL(loc.Text("menu.share"), shareURL)
+
+	menu.Inline(
+		menu.Row(btnShare),
+	)
+
+	return menu
+}
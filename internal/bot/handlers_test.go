@@ -0,0 +1,117 @@
+package bot
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"decodeBot/internal/client"
+	"decodeBot/internal/config"
+	"decodeBot/internal/i18n"
+	"decodeBot/internal/referral"
+
+	tele "gopkg.in/telebot.v4"
+)
+
+// fakeContext records what a handler sends; other Context methods aren't implemented
+type fakeContext struct {
+	tele.Context
+	sender *tele.User
+	sent   []interface{}
+}
+
+func (c *fakeContext) Sender() *tele.User { return c.sender }
+
+func (c *fakeContext) Send(what interface{}, opts ...interface{}) error {
+	c.sent = append(c.sent, what)
+	return nil
+}
+
+// newTestHandler returns a handler whose backend knows no users
+func newTestHandler(t *testing.T, cfg *config.Config) *Handler {
+	t.Helper()
+
+	server := httptest.NewServer(http.NotFoundHandler())
+	t.Cleanup(server.Close)
+	cfg.BotUsername = "decode_bot"
+	return NewHandler(nil, client.NewServerClient(server.URL, cfg.BotSecret), nil, cfg)
+}
+
+// startParam extracts the start parameter from a referral link
+func startParam(t *testing.T, link string) string {
+	t.Helper()
+
+	u, err := url.Parse(link)
+	if err != nil {
+		t.Fatalf("Invalid link %q: %v", link, err)
+	}
+	return u.Query().Get("start")
+}
+
+func TestInviteLinksAreAcceptedByStart(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  config.Config
+	}{
+		{"signed", config.Config{BotSecret: "test-secret"}},
+		{"legacy without secret", config.Config{AllowLegacyReferrals: true}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newTestHandler(t, &tt.cfg)
+			c := &fakeContext{sender: &tele.User{ID: 42}}
+
+			if err := h.HandleInvite(c); err != nil {
+				t.Fatalf("HandleInvite failed: %v", err)
+			}
+			link, err := h.referralLink(42)
+			if err != nil {
+				t.Fatalf("Expected a link, got %v", err)
+			}
+			if len(c.sent) != 1 || !strings.Contains(c.sent[0].(string), link) {
+				t.Fatalf("Expected the invite with %s, got %v", link, c.sent)
+			}
+
+			// The link has to pass the same check HandleStart applies
+			referrerID, err := referral.Parse(startParam(t, link), h.cfg.BotSecret, h.cfg.AllowLegacyReferrals)
+			if err != nil || referrerID != 42 {
+				t.Errorf("Expected /start to accept the link for 42, got %d (%v)", referrerID, err)
+			}
+		})
+	}
+}
+
+func TestInviteWithoutSecretIssuesNoLink(t *testing.T) {
+	h := newTestHandler(t, &config.Config{})
+	c := &fakeContext{sender: &tele.User{ID: 42}}
+
+	if err := h.HandleInvite(c); err != nil {
+		t.Fatalf("HandleInvite failed: %v", err)
+	}
+	want := GetInviteUnavailableMessage(i18n.Default())
+	if len(c.sent) != 1 || c.sent[0] != want {
+		t.Fatalf("Expected the unavailable message, got %v", c.sent)
+	}
+	if link, err := h.referralLink(42); err == nil {
+		t.Errorf("Expected no link without a secret, got %s", link)
+	}
+}
+
+func TestMiniAppScreenURL(t *testing.T) {
+	tests := []struct {
+		appURL string
+		want   string
+	}{
+		{"https://example.com/app/", "https://example.com/app/?board=weekly&screen=leaderboard"},
+		{"https://example.com/app?env=staging", "https://example.com/app?board=weekly&env=staging&screen=leaderboard"},
+	}
+
+	for _, tt := range tests {
+		if got := miniAppScreenURL(tt.appURL, "leaderboard", url.Values{"board": {"weekly"}}); got != tt.want {
+			t.Errorf("Expected %s, got %s", tt.want, got)
+		}
+	}
+}
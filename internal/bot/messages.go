@@ -1,194 +1,180 @@
 package bot
 
 import (
-	"fmt"
+	"log"
 	"math/rand"
 	"time"
+
+	"decodeBot/internal/i18n"
+	"decodeBot/internal/models"
+	"decodeBot/internal/reminders"
 )
 
 func init() {
 	rand.Seed(time.Now().UnixNano())
 }
 
-// GetWelcomeMessage returns the welcome message for /start command
-func GetWelcomeMessage(firstName string) string {
-	return fmt.Sprintf(`🔐 Welcome to DEC0D3, %s!
-
-DEC0D3 is a cyber-themed cipher puzzle game where you decode secret patterns.
-
-🎯 Game Variants:
-• HEX - Decode 4-digit color codes
-• NUMERIC - Guess 5-digit numbers
-• WORD - Find 5-letter English words
+// Texts below come from the i18n catalogs (internal/i18n/locales); the comments list
+// the template arguments by position.
 
-✨ Features:
-• 📅 Daily challenges with streak tracking
-• 🏆 Global leaderboards
-• 💎 Earn shards, get AI hints
-• 🤖 Powered by Gemini AI
-• 🎁 Invite friends and earn +20 shards per referral!
-
-Ready to test your decoding skills?
-Click the button below to start playing! 👇`, firstName)
+// GetWelcomeMessage returns the welcome message for /start command.
+// Arguments: name.
+func GetWelcomeMessage(loc *i18n.Catalog, firstName string) string {
+	return HTML.Sprintf(loc.Text("welcome"), firstName)
 }
 
-// Cyberpunk messages for users WITH streaks
-var streakMessages = []string{
-	// Message 1: System Alert
-	`⚡ SYSTEM BREACH DETECTED
-
-Agent %s, your neural link has been active for %d cycles.
-
-New encrypted data packets await extraction. Daily security protocols require immediate attention.
-
-Continue your streak. Decrypt the codes. 🔐`,
-
-	// Message 2: Network Status
-	`🌐 NETWORK STATUS: ACTIVE
-
-%s | Streak: %d days | Status: ELITE
-
-The grid never sleeps. Today's transmission contains critical intel. Your pattern recognition skills are needed.
-
-Access the mainframe now ⚡`,
-
-	// Message 3: AI Companion
-	`🤖 NEURAL AI REPORT
-
-Hello %s. You've maintained cognitive sync for %d consecutive sessions.
-
-Today's challenge matrix is loaded. The algorithms are waiting for your input. Don't let your streak flatline.
-
-Engage protocols 🧠`,
-
-	// Message 4: Urgent Transmission
-	`📡 INCOMING: Priority Signal
-
-%s, you're %d days deep in the simulation.
-
-Today's ciphertext just dropped. The corporation doesn't rest, and neither should you. Decode before the window closes.
-
-Stay connected 🔴`,
-
-	// Message 5: Hacker Collective
-	`👾 COLLECTIVE BROADCAST
-
-%s - %d day operative streak recorded.
-
-New targets identified. Your decryption skills put you in the top tier. The puzzles won't solve themselves, agent.
-
-Jack in 🎮`,
-
-	// Message 6: Memory Fragment
-	`💾 MEMORY FRAGMENT DETECTED
-
-Agent %s, %d continuous days logged in the archives.
-
-Fresh data corruption needs your expertise. The hex, numeric, and word layers all require your touch. Time-sensitive.
-
-Initialize sequence 🔍`,
-
-	// Message 7: Glitch Aesthetic
-	`█▀▀ █▀█ █▀▄ █▀▀   █▀▄ █▀█ █▀█ █▀█
-█▄▄ █▄█ █▄▀ ██▄   █▄▀ █▀▄ █▄█ █▀▀
-
-%s // STREAK: %d DAYS
-
-New patterns emerged in the noise. Your presence is required for analysis. Don't break the chain.
-
->_ Execute now`,
-
-	// Message 8: Surveillance Warning
-	`👁️ SURVEILLANCE DETECTED
-
-%s, you've been tracked for %d days straight.
-
-They're watching your moves. Today's encrypted challenges are your only defense. Stay sharp, stay decoding, stay ahead.
-
-Don't go dark now 🌙`,
-
-	// Message 9: Crypto Mining
-	`⛏️ CRYPTO MINING STATUS
-
-Miner: %s | Uptime: %d days
-
-Fresh hash puzzles ready for processing. Your neural network performance has been exceptional. Keep the computational power flowing.
-
-Mine the codes 💎`,
-
-	// Message 10: Reality Glitch
-	`🔮 REALITY.EXE UNSTABLE
-
-%s, the simulation recognizes your %d-day presence.
-
-Today's glitches in the matrix reveal new patterns. Decode them before they vanish. The red pill is daily challenges.
+// GetDailyReminderMessage returns today's cyberpunk-themed daily reminder for a user,
+// rotating through the variants so the same one doesn't come back day after day,
+// along with the variant it used. The variant is empty when the fallback text was sent.
+// The texts are the reminder templates (internal/reminders), not catalog entries.
+func GetDailyReminderMessage(templates *reminders.Store, loc *i18n.Catalog, telegramID int64, firstName string, currentStreak int) (string, reminders.Choice) {
+	kind := reminders.KindNoStreak
+	if currentStreak > 0 {
+		kind = reminders.KindStreak
+	}
 
-Enter the void ⚡`,
+	choice := templates.Pick(loc.Lang(), kind, telegramID)
+	message, err := choice.Render(reminders.Data{
+		Name:   EscapeHTML(firstName),
+		Streak: currentStreak,
+		Days:   EscapeHTML(loc.Plural("days", currentStreak)),
+	})
+	if err != nil {
+		// Templates are validated on load, so this means a bug rather than a bad file
+		log.Printf("[TEMPLATES] Failed to render %s/%s/%s: %v", loc.Lang(), kind, choice.ID, err)
+		return HTML.Sprintf(loc.Text("reminder.fallback"), firstName), reminders.Choice{}
+	}
+	return message, choice
 }
 
-// Cyberpunk messages for users WITHOUT streaks
-var noStreakMessages = []string{
-	// Message A: New Agent Onboarding
-	`🌐 INITIALIZATION SEQUENCE
-
-Welcome, Agent %s.
-
-The network has registered your presence. Daily operations begin now. Your first mission: decrypt today's data streams.
+// GetStreakStatsMessage returns the personal stats card for /stats.
+// Arguments: name, games won, current streak, daily streak in days, shards, referrals, last played.
+func GetStreakStatsMessage(loc *i18n.Catalog, profile *models.UserProfile) string {
+	return HTML.Sprintf(loc.Text("stats"),
+		displayName(loc, profile.FirstName),
+		profile.TotalGamesWon,
+		profile.CurrentStreak,
+		loc.Plural("days", profile.DailyStreak),
+		profile.ShardBalance,
+		profile.ReferralCount,
+		formatLastPlayed(loc, profile.LastPlayedAt, time.Now()),
+	)
+}
 
-Start your streak. Prove your worth 🔐`,
+// GetStatsUnavailableMessage is shown when the server can't be reached
+func GetStatsUnavailableMessage(loc *i18n.Catalog) string {
+	return loc.Text("stats.unavailable")
+}
 
-	// Message B: System Reboot
-	`⚡ NEURAL LINK: RECONNECTING
+// GetStatsUnknownUserMessage is shown when the server has no profile for the user yet
+func GetStatsUnknownUserMessage(loc *i18n.Catalog) string {
+	return loc.Text("stats.unknown_user")
+}
 
-%s, systems are back online.
+// GetInviteUnavailableMessage is shown when no referral link can be issued
+func GetInviteUnavailableMessage(loc *i18n.Catalog) string {
+	return loc.Text("invite.unavailable")
+}
 
-You've been offline too long. The codes are piling up. Today's your chance to re-establish your streak and climb the ranks.
+// GetInviteMessage returns the /invite message with the personal referral link.
+// A negative referralCount means the count couldn't be fetched and is omitted.
+// Arguments: referral counter line, link.
+func GetInviteMessage(loc *i18n.Catalog, link string, referralCount int) string {
+	counter := ""
+	if referralCount >= 0 {
+		counter = HTML.Sprintf(loc.Text("invite.counter"), referralCount)
+	}
 
-Reboot complete. Deploy now 🤖`,
+	return HTML.Sprintf(loc.Text("invite"), Safe(counter), link)
+}
 
-	// Message C: Recruitment
-	`📡 RECRUITMENT: ACTIVE
+// GetReferralMessage tells a referrer that someone joined through their link.
+// Arguments: referred user's name.
+func GetReferralMessage(loc *i18n.Catalog, referredName string) string {
+	return HTML.Sprintf(loc.Text("referral"), referredName)
+}
 
-The collective needs decoders like you, %s.
+// GetInviteShareText returns the text prefilled in Telegram's share dialog.
+// It is plain text, not HTML, since it travels in the share URL.
+func GetInviteShareText(loc *i18n.Catalog) string {
+	return loc.Text("invite.share")
+}
 
-Fresh intel just hit the network. HEX signatures, NUMERIC sequences, WORD ciphers—all waiting. Start your operation today.
+// GetTimezoneUsageMessage explains the /timezone command, suggesting a zone when one can be guessed.
+// Arguments: example zone.
+func GetTimezoneUsageMessage(loc *i18n.Catalog, suggested string) string {
+	example := suggested
+	if example == "" {
+		example = "Europe/Warsaw"
+	}
 
-Join the elite 👾`,
+	return HTML.Sprintf(loc.Text("timezone.usage"), example)
+}
 
-	// Message D: Challenge Issued
-	`💾 NEW CHALLENGER DETECTED
+// GetTimezoneInvalidMessage is shown when the user sends an unknown zone name.
+// Arguments: zone.
+func GetTimezoneInvalidMessage(loc *i18n.Catalog, zone string) string {
+	return HTML.Sprintf(loc.Text("timezone.invalid"), zone)
+}
 
-%s, your skills haven't been forgotten.
+// GetTimezoneUpdatedMessage confirms the new timezone and the quiet hours that apply.
+// Arguments: zone, quiet hours start, quiet hours end.
+func GetTimezoneUpdatedMessage(loc *i18n.Catalog, zone string, quietStart, quietEnd int) string {
+	return HTML.Sprintf(loc.Text("timezone.updated"), zone, quietStart, quietEnd)
+}
 
-The system remembers your last session. Today's challenges are calling. Build your streak from zero. Show them you're still sharp.
+// GetTimezoneUnavailableMessage is shown when the timezone couldn't be saved on the server
+func GetTimezoneUnavailableMessage(loc *i18n.Catalog) string {
+	return loc.Text("timezone.unavailable")
+}
 
-Accept protocol? Y/N_ 🔍`,
+// GetTimezoneUnknownUserMessage is shown when the server has no account for the user yet
+func GetTimezoneUnknownUserMessage(loc *i18n.Catalog) string {
+	return loc.Text("timezone.unknown_user")
+}
 
-	// Message E: Data Leak
-	`🔴 DATA LEAK IN PROGRESS
+// GetLanguagePromptMessage introduces the /language keyboard.
+// Arguments: current language name.
+func GetLanguagePromptMessage(loc *i18n.Catalog) string {
+	return HTML.Sprintf(loc.Text("language.prompt"), loc.Text("language.name"))
+}
 
-%s, unauthorized access detected in sector 7.
+// GetLanguageUpdatedMessage confirms the new language, in that language.
+// Arguments: language name.
+func GetLanguageUpdatedMessage(loc *i18n.Catalog) string {
+	return HTML.Sprintf(loc.Text("language.updated"), loc.Text("language.name"))
+}
 
-Only elite decoders can patch the breach. Today's puzzles hold the key. Start your streak and secure the network.
+// GetLanguageUnavailableMessage is shown when the language couldn't be saved on the server
+func GetLanguageUnavailableMessage(loc *i18n.Catalog) string {
+	return loc.Text("language.unavailable")
+}
 
-Time is running out ⚡`,
+// GetLanguageUnknownUserMessage is shown when the server has no account for the user yet
+func GetLanguageUnknownUserMessage(loc *i18n.Catalog) string {
+	return loc.Text("language.unknown_user")
 }
 
-// GetDailyReminderMessage returns a random cyberpunk-themed daily reminder message
-func GetDailyReminderMessage(firstName string, currentStreak int) string {
-	if currentStreak > 0 {
-		// Random message from streak messages
-		idx := rand.Intn(len(streakMessages))
-		return fmt.Sprintf(streakMessages[idx], firstName, currentStreak)
+// formatLastPlayed converts the server timestamp to a human-readable relative time
+func formatLastPlayed(loc *i18n.Catalog, lastPlayedAt string, now time.Time) string {
+	if lastPlayedAt == "" {
+		return loc.Text("last_played.never")
 	}
 
-	// Random message from no-streak messages
-	idx := rand.Intn(len(noStreakMessages))
-	return fmt.Sprintf(noStreakMessages[idx], firstName)
-}
+	t, err := time.Parse(time.RFC3339, lastPlayedAt)
+	if err != nil {
+		return loc.Text("last_played.unknown")
+	}
 
-// GetStreakStatsMessage returns daily streak statistics
-func GetStreakStatsMessage(profile interface{}) string {
-	// We'll implement this when we have the profile structure from server
-	return "📊 Your streak stats will appear here!"
+	d := now.Sub(t)
+	switch {
+	case d < time.Minute:
+		return loc.Text("last_played.just_now")
+	case d < time.Hour:
+		return loc.Plural("last_played.minutes", int(d.Minutes()))
+	case d < 24*time.Hour:
+		return loc.Plural("last_played.hours", int(d.Hours()))
+	default:
+		return loc.Plural("last_played.days", int(d.Hours())/24)
+	}
 }
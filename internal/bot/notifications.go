@@ -0,0 +1,249 @@
+package bot
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+
+	"decodeBot/internal/i18n"
+	"decodeBot/internal/models"
+)
+
+// Achievement rarities sent by the backend
+const (
+	RarityCommon    = "common"
+	RarityRare      = "rare"
+	RarityEpic      = "epic"
+	RarityLegendary = "legendary"
+)
+
+// GetAchievementMessage returns a random cyberpunk-themed announcement for an unlocked achievement.
+// Arguments: name, achievement title, rarity badge.
+func GetAchievementMessage(loc *i18n.Catalog, firstName, title, rarity string, shards int) string {
+	messages := loc.Alternatives("achievement")
+	idx := rand.Intn(len(messages))
+	message := HTML.Sprintf(messages[idx], displayName(loc, firstName), title, rarityBadge(loc, rarity))
+
+	if strings.EqualFold(rarity, RarityLegendary) {
+		message += "\n\n" + loc.Text("achievement.legendary")
+	}
+	if shards > 0 {
+		message += "\n\n" + HTML.Sprintf(loc.Text("achievement.shards"), shards)
+	}
+
+	return message + "\n\n" + loc.Text("achievement.footer")
+}
+
+// rarityBadge returns the label for a rarity, passing unknown ones through
+func rarityBadge(loc *i18n.Catalog, rarity string) string {
+	if rarity == "" {
+		rarity = RarityCommon
+	}
+	switch rarity = strings.ToLower(rarity); rarity {
+	case RarityCommon, RarityRare, RarityEpic, RarityLegendary:
+		return loc.Text("rarity." + rarity)
+	}
+	return "◻️ " + strings.ToUpper(rarity)
+}
+
+// Game variants with their own streaks
+const (
+	VariantHex     = "hex"
+	VariantWord    = "word"
+	VariantNumeric = "numeric"
+)
+
+// variantStreak is one variant's streak, labelled for display
+type variantStreak struct {
+	label string
+	days  int
+}
+
+// variantStreaks lists the user's per-variant streaks in display order
+func variantStreaks(user *models.User) []variantStreak {
+	return []variantStreak{
+		{"HEX", user.HexStreak},
+		{"WORD", user.WordStreak},
+		{"NUMERIC", user.NumericStreak},
+	}
+}
+
+// StreakFor returns the user's streak for a variant, or the overall streak when variant is empty
+func StreakFor(user *models.User, variant string) int {
+	switch strings.ToLower(variant) {
+	case VariantHex:
+		return user.HexStreak
+	case VariantWord:
+		return user.WordStreak
+	case VariantNumeric:
+		return user.NumericStreak
+	default:
+		return user.AllStreak
+	}
+}
+
+// ValidVariant reports whether variant names a game variant; empty means all variants
+func ValidVariant(variant string) bool {
+	switch strings.ToLower(variant) {
+	case "", VariantHex, VariantWord, VariantNumeric:
+		return true
+	}
+	return false
+}
+
+// variantLabel returns the display name of a variant's streak
+func variantLabel(variant string) string {
+	if variant == "" {
+		return "DAILY"
+	}
+	return strings.ToUpper(variant)
+}
+
+// GetStreakAtRiskMessage warns that a streak resets soon.
+// An empty variant refers to the overall daily streak.
+// Arguments: name, streak length, variant label, time left.
+func GetStreakAtRiskMessage(loc *i18n.Catalog, user *models.User, variant string, hoursLeft int) string {
+	timeLeft := loc.Text("streak.less_than_hour")
+	if hoursLeft > 0 {
+		timeLeft = loc.Plural("hours", hoursLeft)
+	}
+
+	messages := loc.Alternatives("streak.at_risk")
+	idx := rand.Intn(len(messages))
+	message := HTML.Sprintf(messages[idx],
+		displayName(loc, user.FirstName), StreakFor(user, variant), variantLabel(variant), timeLeft)
+
+	if summary := streakSummary(user); summary != "" {
+		message += HTML.Sprintf("\n\n%s", summary)
+	}
+	return message
+}
+
+// GetStreakBrokenMessage tells the user a streak was lost and nudges them to start over.
+// An empty variant refers to the overall daily streak.
+// Arguments: name, lost streak length, variant label.
+func GetStreakBrokenMessage(loc *i18n.Catalog, user *models.User, variant string, lostStreak int) string {
+	messages := loc.Alternatives("streak.broken")
+	idx := rand.Intn(len(messages))
+	message := HTML.Sprintf(messages[idx],
+		displayName(loc, user.FirstName), lostStreak, variantLabel(variant))
+
+	if summary := streakSummary(user); summary != "" {
+		message += "\n\n" + HTML.Sprintf(loc.Text("streak.still_running"), summary)
+	}
+	return message
+}
+
+// streakSummary lists the user's active per-variant streaks, e.g. "🔥 HEX 5 · WORD 2"
+func streakSummary(user *models.User) string {
+	var parts []string
+	for _, s := range variantStreaks(user) {
+		if s.days > 0 {
+			parts = append(parts, fmt.Sprintf("%s %d", s.label, s.days))
+		}
+	}
+	if len(parts) == 0 {
+		return ""
+	}
+	return "🔥 " + strings.Join(parts, " · ")
+}
+
+// displayName falls back to "Agent" for users without a first name
+func displayName(loc *i18n.Catalog, firstName string) string {
+	if firstName == "" {
+		return loc.Text("agent")
+	}
+	return firstName
+}
+
+// Leaderboards a user can be overtaken on
+const (
+	BoardDaily  = "daily"
+	BoardGlobal = "global"
+)
+
+// Overtake is one rival passing the user on a leaderboard
+type Overtake struct {
+	RivalName string
+	Board     string // BoardDaily or BoardGlobal
+	Variant   string // empty for the combined board
+	OldRank   int
+	NewRank   int
+}
+
+// boardLabel returns the display name of a leaderboard, e.g. "DAILY HEX"
+func (o Overtake) boardLabel() string {
+	label := strings.ToUpper(o.Board)
+	if o.Variant != "" {
+		label += " " + strings.ToUpper(o.Variant)
+	}
+	return label
+}
+
+// ValidBoard reports whether board names a leaderboard
+func ValidBoard(board string) bool {
+	return board == BoardDaily || board == BoardGlobal
+}
+
+// GetOvertakenMessage taunts the user about a rival passing them.
+// Arguments: name, rival name, board label, ranks lost, new rank.
+func GetOvertakenMessage(loc *i18n.Catalog, firstName string, o Overtake) string {
+	messages := loc.Alternatives("overtaken")
+	idx := rand.Intn(len(messages))
+	return HTML.Sprintf(messages[idx],
+		displayName(loc, firstName), o.RivalName, o.boardLabel(), loc.Plural("places", o.NewRank-o.OldRank), o.NewRank)
+}
+
+// GetOvertakenSummaryMessage collapses several overtakes into one message,
+// with the net rank change per leaderboard.
+// Arguments: name, number of overtakes, one line per board (board, from, to, rivals).
+func GetOvertakenSummaryMessage(loc *i18n.Catalog, firstName string, overtakes []Overtake) string {
+	if len(overtakes) == 1 {
+		return GetOvertakenMessage(loc, firstName, overtakes[0])
+	}
+
+	type boardChange struct {
+		label   string
+		from    int
+		to      int
+		rivals  []string
+		counted map[string]bool
+	}
+
+	var order []string
+	boards := make(map[string]*boardChange)
+	for _, o := range overtakes {
+		label := o.boardLabel()
+		b, ok := boards[label]
+		if !ok {
+			b = &boardChange{label: label, from: o.OldRank, counted: make(map[string]bool)}
+			boards[label] = b
+			order = append(order, label)
+		}
+		b.to = o.NewRank
+		if !b.counted[o.RivalName] {
+			b.counted[o.RivalName] = true
+			b.rivals = append(b.rivals, o.RivalName)
+		}
+	}
+
+	var lines []string
+	for _, label := range order {
+		b := boards[label]
+		lines = append(lines, HTML.Sprintf(loc.Text("overtaken.summary_line"), b.label, b.from, b.to, listNames(loc, b.rivals, 3)))
+	}
+
+	return HTML.Sprintf(loc.Text("overtaken.summary"),
+		displayName(loc, firstName), loc.Plural("overtakes", len(overtakes)), Safe(strings.Join(lines, "\n")))
+}
+
+// listNames joins up to max names, summarizing the rest, e.g. "Trinity, Morpheus and 2 more"
+func listNames(loc *i18n.Catalog, names []string, max int) string {
+	if len(names) <= max {
+		if len(names) == 1 {
+			return names[0]
+		}
+		return fmt.Sprintf(loc.Text("names.and"), strings.Join(names[:len(names)-1], ", "), names[len(names)-1])
+	}
+	return fmt.Sprintf(loc.Text("names.and_more"), strings.Join(names[:max], ", "), len(names)-max)
+}
@@ -2,7 +2,9 @@ package client
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
@@ -12,6 +14,13 @@ import (
 	"decodeBot/internal/models"
 )
 
+var (
+	// ErrUserNotFound is returned when the server has no record of the requested user
+	ErrUserNotFound = errors.New("user not found")
+	// ErrLeaseLost is returned when acking a job whose lease expired or belongs to another worker
+	ErrLeaseLost = errors.New("job lease lost")
+)
+
 type ServerClient struct {
 	baseURL    string
 	botSecret  string
@@ -40,6 +49,15 @@ func (c *ServerClient) doWithRetry(req *http.Request) (*http.Response, error) {
 	var err error
 
 	for attempt := 0; attempt <= c.maxRetries; attempt++ {
+		// The previous attempt consumed the body, so give the retry a fresh copy
+		if attempt > 0 && req.GetBody != nil {
+			body, bodyErr := req.GetBody()
+			if bodyErr != nil {
+				return nil, bodyErr
+			}
+			req.Body = body
+		}
+
 		resp, err = c.httpClient.Do(req)
 
 		// Success - return immediately
@@ -70,7 +88,11 @@ func (c *ServerClient) doWithRetry(req *http.Request) (*http.Response, error) {
 			resp.Body.Close()
 		}
 
-		time.Sleep(delay)
+		select {
+		case <-time.After(delay):
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		}
 	}
 
 	return resp, err
@@ -142,6 +164,10 @@ func (c *ServerClient) GetUserProfile(telegramID int64) (*models.UserProfile, er
 	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, ErrUserNotFound
+	}
+
 	if resp.StatusCode != http.StatusOK {
 		body, _ := io.ReadAll(resp.Body)
 		return nil, fmt.Errorf("failed to get user profile: %d - %s", resp.StatusCode, string(body))
@@ -155,6 +181,111 @@ func (c *ServerClient) GetUserProfile(telegramID int64) (*models.UserProfile, er
 	return &profile, nil
 }
 
+// UpdateUserTimezone stores the user's IANA timezone on the server
+func (c *ServerClient) UpdateUserTimezone(telegramID int64, timezone string) error {
+	data, err := json.Marshal(models.TimezoneRequest{Timezone: timezone})
+	if err != nil {
+		return err
+	}
+
+	url := fmt.Sprintf("%s/api/bot/users/%d/timezone", c.baseURL, telegramID)
+	req, err := http.NewRequest("POST", url, bytes.NewBuffer(data))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	if c.botSecret != "" {
+		req.Header.Set("X-Bot-Secret", c.botSecret)
+	}
+
+	resp, err := c.doWithRetry(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return ErrUserNotFound
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("failed to update timezone: %d - %s", resp.StatusCode, string(body))
+	}
+
+	return nil
+}
+
+// UpdateUserLanguage stores the language the user picked with /language
+func (c *ServerClient) UpdateUserLanguage(telegramID int64, languageCode string) error {
+	data, err := json.Marshal(models.LanguageRequest{LanguageCode: languageCode})
+	if err != nil {
+		return err
+	}
+
+	url := fmt.Sprintf("%s/api/bot/users/%d/language", c.baseURL, telegramID)
+	req, err := http.NewRequest("POST", url, bytes.NewBuffer(data))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	if c.botSecret != "" {
+		req.Header.Set("X-Bot-Secret", c.botSecret)
+	}
+
+	resp, err := c.doWithRetry(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return ErrUserNotFound
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("failed to update language: %d - %s", resp.StatusCode, string(body))
+	}
+
+	return nil
+}
+
+// MarkUserUnreachable tells the server the bot can no longer message this user
+// (blocked, deactivated, chat gone) so it stops scheduling notifications for them
+func (c *ServerClient) MarkUserUnreachable(telegramID int64, reason string) error {
+	data, err := json.Marshal(models.UnreachableRequest{Reason: reason})
+	if err != nil {
+		return err
+	}
+
+	url := fmt.Sprintf("%s/api/bot/users/%d/unreachable", c.baseURL, telegramID)
+	req, err := http.NewRequest("POST", url, bytes.NewBuffer(data))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	if c.botSecret != "" {
+		req.Header.Set("X-Bot-Secret", c.botSecret)
+	}
+
+	resp, err := c.doWithRetry(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("failed to mark user unreachable: %d - %s", resp.StatusCode, string(body))
+	}
+
+	return nil
+}
+
 // ProcessReferral processes a referral and awards shards
 func (c *ServerClient) ProcessReferral(referrerID, referredID int64) (*models.ReferralResponse, error) {
 	req := models.ReferralRequest{
@@ -191,6 +322,18 @@ func (c *ServerClient) ProcessReferral(referrerID, referredID int64) (*models.Re
 	return &refResp, nil
 }
 
+// Notification job statuses reported back to the server
+const (
+	JobStatusPending      = "PENDING"
+	JobStatusSent         = "SENT"
+	JobStatusFailed       = "FAILED"
+	JobStatusBlocked      = "BLOCKED"
+	JobStatusDeactivated  = "DEACTIVATED"
+	JobStatusChatNotFound = "CHAT_NOT_FOUND"
+	JobStatusRetry        = "RETRY"
+	JobStatusDeadLetter   = "DEAD_LETTER"
+)
+
 // NotificationJob represents a scheduled notification
 type NotificationJob struct {
 	ID         uint  `json:"id"`
@@ -206,7 +349,24 @@ type NotificationJob struct {
 	Type        string       `json:"type"`
 	ScheduledAt time.Time    `json:"scheduled_at"`
 	Status      string       `json:"status"`
-	User        *models.User `json:"user"` // Nested user object
+	Attempts    int          `json:"attempts"` // Failed delivery attempts so far
+	User        *models.User `json:"user"`     // Nested user object
+
+	// Set when the job was claimed; updates must carry the token while the lease is valid
+	LeaseToken     string    `json:"lease_token,omitempty"`
+	LeaseExpiresAt time.Time `json:"lease_expires_at"`
+}
+
+// claimRequest is the payload for leasing pending jobs to a single worker
+type claimRequest struct {
+	WorkerID     string `json:"worker_id"`
+	Limit        int    `json:"limit"`
+	LeaseSeconds int    `json:"lease_seconds"`
+}
+
+// claimResponse holds the jobs leased to this worker
+type claimResponse struct {
+	Jobs []NotificationJob `json:"jobs"`
 }
 
 // ScheduleNotifications triggers manual scheduling on server
@@ -270,16 +430,128 @@ func (c *ServerClient) GetPendingNotifications(limit int) ([]NotificationJob, er
 	return jobs, nil
 }
 
+// ClaimNotifications atomically leases up to limit due jobs to workerID for ttl.
+// Claimed jobs are hidden from other workers until acked or the lease expires,
+// so several bot replicas can poll the same queue without double-sending.
+func (c *ServerClient) ClaimNotifications(workerID string, limit int, ttl time.Duration) ([]NotificationJob, error) {
+	data, err := json.Marshal(claimRequest{
+		WorkerID:     workerID,
+		Limit:        limit,
+		LeaseSeconds: int(ttl.Seconds()),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	url := c.baseURL + "/api/bot/notifications/claim"
+	req, err := http.NewRequest("POST", url, bytes.NewBuffer(data))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if c.botSecret != "" {
+		req.Header.Set("X-Bot-Secret", c.botSecret)
+	}
+
+	// Not retried: a retry after a lost response would lease a second batch
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		log.Printf("[CLIENT] Request failed: %v", err)
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to claim notifications: %d", resp.StatusCode)
+	}
+
+	var claim claimResponse
+	if err := json.NewDecoder(resp.Body).Decode(&claim); err != nil {
+		return nil, err
+	}
+	return claim.Jobs, nil
+}
+
 // UpdateJobStatus updates the status of a job
 func (c *ServerClient) UpdateJobStatus(jobID uint, status string) error {
-	payload := map[string]string{"status": status}
+	return c.updateJob(jobID, map[string]interface{}{"status": status})
+}
+
+// AckJob reports the final status of a claimed job and releases its lease.
+// Returns ErrLeaseLost if the lease expired and the job was handed to another worker.
+func (c *ServerClient) AckJob(job NotificationJob, status string) error {
+	return c.updateJob(job.ID, map[string]interface{}{
+		"status":      status,
+		"lease_token": job.LeaseToken,
+	})
+}
+
+// JobVariant identifies the copy a job was sent with, so the server can join it to
+// whether the user came back to play
+type JobVariant struct {
+	ID         string // reminder template variant, e.g. "system_breach"
+	Experiment string // experiment that assigned the variant; empty for the regular rotation
+}
+
+// AckSentJob reports a delivered job along with the variant it was sent with.
+// Returns ErrLeaseLost like AckJob.
+func (c *ServerClient) AckSentJob(job NotificationJob, variant JobVariant) error {
+	payload := map[string]interface{}{
+		"status":      JobStatusSent,
+		"lease_token": job.LeaseToken,
+	}
+	if variant.ID != "" {
+		payload["variant_id"] = variant.ID
+	}
+	if variant.Experiment != "" {
+		payload["experiment"] = variant.Experiment
+	}
+	return c.updateJob(job.ID, payload)
+}
+
+// RetryJob records a failed attempt on a claimed job and asks the server to hand it out again at nextAttemptAt
+func (c *ServerClient) RetryJob(job NotificationJob, attempts int, nextAttemptAt time.Time) error {
+	return c.updateJob(job.ID, map[string]interface{}{
+		"status":          JobStatusRetry,
+		"lease_token":     job.LeaseToken,
+		"attempts":        attempts,
+		"next_attempt_at": nextAttemptAt.UTC().Format(time.RFC3339),
+	})
+}
+
+// DeferJob puts a claimed job back into the queue to be picked up again at the given time
+func (c *ServerClient) DeferJob(job NotificationJob, until time.Time) error {
+	return c.updateJob(job.ID, map[string]interface{}{
+		"status":       JobStatusPending,
+		"lease_token":  job.LeaseToken,
+		"scheduled_at": until.UTC().Format(time.RFC3339),
+	})
+}
+
+// ReleaseJob hands a claimed job back for immediate pickup, giving up when ctx ends.
+// Used on shutdown, where the call must not outlive the process deadline.
+func (c *ServerClient) ReleaseJob(ctx context.Context, job NotificationJob) error {
+	return c.updateJobContext(ctx, job.ID, map[string]interface{}{
+		"status":       JobStatusPending,
+		"lease_token":  job.LeaseToken,
+		"scheduled_at": time.Now().UTC().Format(time.RFC3339),
+	})
+}
+
+// updateJob posts a job update payload to the server
+func (c *ServerClient) updateJob(jobID uint, payload map[string]interface{}) error {
+	return c.updateJobContext(context.Background(), jobID, payload)
+}
+
+// updateJobContext posts a job update payload to the server, bounded by ctx
+func (c *ServerClient) updateJobContext(ctx context.Context, jobID uint, payload map[string]interface{}) error {
 	data, err := json.Marshal(payload)
 	if err != nil {
 		return err
 	}
 
 	url := fmt.Sprintf("%s/api/bot/notifications/%d", c.baseURL, jobID)
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(data))
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(data))
 	if err != nil {
 		return err
 	}
@@ -294,8 +566,12 @@ func (c *ServerClient) UpdateJobStatus(jobID uint, status string) error {
 	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode == http.StatusConflict {
+		return ErrLeaseLost
+	}
+
 	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("failed to update job status: %d", resp.StatusCode)
+		return fmt.Errorf("failed to update job %d: %d", jobID, resp.StatusCode)
 	}
 	return nil
 }
@@ -2,9 +2,13 @@ package client
 
 import (
 	"encoding/json"
+	"errors"
+	"io"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 
 	"decodeBot/internal/models"
 )
@@ -102,3 +106,100 @@ func TestProcessReferral(t *testing.T) {
 		t.Errorf("Expected 20 shards, got %d", resp.ShardsAwarded)
 	}
 }
+
+func TestGetUserProfileNotFound(t *testing.T) {
+	// Mock Server
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Verify URL
+		if r.URL.Path != "/api/bot/stats/333" {
+			t.Errorf("Expected path /api/bot/stats/333, got %s", r.URL.Path)
+		}
+
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	// Init Client
+	client := NewServerClient(server.URL, "test-secret")
+
+	// Execute
+	profile, err := client.GetUserProfile(333)
+
+	// Assert
+	if !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("Expected ErrUserNotFound, got %v", err)
+	}
+	if profile != nil {
+		t.Errorf("Expected nil profile, got %v", profile)
+	}
+}
+
+func TestUpdateUserLanguage(t *testing.T) {
+	// Mock Server
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Verify URL
+		if r.URL.Path != "/api/bot/users/42/language" {
+			t.Errorf("Expected path /api/bot/users/42/language, got %s", r.URL.Path)
+		}
+
+		// Verify Body
+		var req models.LanguageRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("Failed to decode body: %v", err)
+		}
+		if req.LanguageCode != "pl" {
+			t.Errorf("Expected language_code pl, got %q", req.LanguageCode)
+		}
+
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	// Init Client
+	client := NewServerClient(server.URL, "test-secret")
+
+	// Execute
+	if err := client.UpdateUserLanguage(42, "pl"); err != nil {
+		t.Errorf("UpdateUserLanguage returned error: %v", err)
+	}
+}
+
+// roundTripFunc serves requests without a network. Unlike http.Transport, it doesn't
+// rewind request bodies itself, so retries only see what doWithRetry gives them.
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) { return f(r) }
+
+func TestRetryResendsBody(t *testing.T) {
+	calls := 0
+	client := NewServerClient("http://backend.test", "test-secret")
+	client.retryDelay = time.Millisecond
+	client.httpClient.Transport = roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		calls++
+		status := http.StatusOK
+		if calls == 1 {
+			// Sending a request consumes its body, whatever the answer
+			io.Copy(io.Discard, r.Body)
+			status = http.StatusInternalServerError
+		} else {
+			var req struct {
+				Status     string `json:"status"`
+				LeaseToken string `json:"lease_token"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				t.Errorf("Failed to decode retried body: %v", err)
+			}
+			if req.Status != JobStatusSent || req.LeaseToken != "lease-1" {
+				t.Errorf("Expected the retry to carry status and lease_token, got %+v", req)
+			}
+		}
+		return &http.Response{StatusCode: status, Body: io.NopCloser(strings.NewReader("")), Header: http.Header{}}, nil
+	})
+
+	if err := client.AckJob(NotificationJob{ID: 7, LeaseToken: "lease-1"}, JobStatusSent); err != nil {
+		t.Errorf("AckJob returned error: %v", err)
+	}
+	if calls != 2 {
+		t.Errorf("Expected 2 requests, got %d", calls)
+	}
+}
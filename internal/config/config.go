@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"strconv"
+	"time"
 )
 
 type Config struct {
@@ -15,8 +17,54 @@ type Config struct {
 	Debug       bool
 	AdminID     int64
 	WebhookPort string // Port for webhook HTTP server
+
+	AllowLegacyReferrals bool // Accept unsigned ref_<id> deep links
+
+	DefaultTimezone *time.Location // Used for users without a known timezone
+	QuietHoursStart int            // Local hour when notifications pause
+	QuietHoursEnd   int            // Local hour when notifications resume
+
+	NotifyBatchSize   int     // Jobs fetched per scheduler run
+	NotifyConcurrency int     // Parallel notification send workers
+	SendRateGlobal    float64 // Max messages per second across all chats
+	SendRatePerChat   float64 // Max messages per second to a single chat
+	NotifyMaxAttempts int     // Delivery attempts before a job is dead-lettered
+
+	NotifyLeaseTTL time.Duration // How long claimed jobs stay reserved for this replica
+
+	ShutdownTimeout time.Duration // Time allowed to drain sends and requests on SIGTERM
+
+	UpdateMode            string // "polling" (default) or "webhook"
+	TelegramWebhookURL    string // Public HTTPS URL registered with Telegram
+	TelegramWebhookPath   string // Path on the shared webhook listener
+	TelegramWebhookSecret string // Secret token Telegram sends with every update
+	TelegramWebhookListen string // Optional dedicated listen address instead of the shared listener
+	TelegramWebhookCert   string // Optional TLS certificate path (also uploaded for self-signed certs)
+	TelegramWebhookKey    string // Optional TLS key path for the dedicated listener
+
+	WebhookMaxSkew              time.Duration // Allowed clock skew for signed backend webhooks
+	WebhookAllowLegacySecret    bool          // Accept the static X-Bot-Secret header instead of a signature
+	WebhookAllowUnauthenticated bool          // Start the webhook server even without BOT_SECRET
+	WebhookIdempotencyTTL       time.Duration // How long delivered event IDs are remembered
+	WebhookBatchMaxEvents       int           // Most events accepted in one /webhook/batch request
+
+	LeaderboardThrottle time.Duration // Minimum gap between leaderboard notifications to one user
+
+	ReminderTemplatesDir  string        // Optional directory of reminder templates overriding the built-in ones
+	ReminderTemplatesPoll time.Duration // How often the override directory is checked for changes
+	ExperimentsFile       string        // Optional JSON file of A/B tests on reminder copy
+
+	OutboxPath      string // Journal file for outgoing messages not yet sent
+	OutboxQueueSize int    // Messages waiting to be sent before new ones are refused
+	OutboxWorkers   int    // Parallel outgoing message workers
 }
 
+// Update delivery modes
+const (
+	UpdateModePolling = "polling"
+	UpdateModeWebhook = "webhook"
+)
+
 func Load() *Config {
 	debug := os.Getenv("DEBUG") == "true"
 
@@ -34,6 +82,34 @@ func Load() *Config {
 		webhookPort = "8082" // Default webhook port
 	}
 
+	// Unsigned ref_ links can be forged, so they're only accepted when explicitly enabled
+	allowLegacyReferrals := os.Getenv("ALLOW_LEGACY_REFERRALS") == "true"
+
+	defaultTimezone := time.UTC
+	if tz := os.Getenv("DEFAULT_TIMEZONE"); tz != "" {
+		loc, err := time.LoadLocation(tz)
+		if err != nil {
+			log.Printf("⚠️  Invalid DEFAULT_TIMEZONE %q, using UTC: %v", tz, err)
+		} else {
+			defaultTimezone = loc
+		}
+	}
+
+	outboxPath := os.Getenv("OUTBOX_PATH")
+	if outboxPath == "" {
+		outboxPath = "data/outbox.jsonl"
+	}
+
+	updateMode := os.Getenv("UPDATE_MODE")
+	if updateMode == "" {
+		updateMode = UpdateModePolling
+	}
+
+	telegramWebhookPath := os.Getenv("TELEGRAM_WEBHOOK_PATH")
+	if telegramWebhookPath == "" {
+		telegramWebhookPath = "/telegram/webhook"
+	}
+
 	cfg := &Config{
 		BotToken:    os.Getenv("BOT_TOKEN"),
 		BotUsername: os.Getenv("BOT_USERNAME"),
@@ -43,12 +119,66 @@ func Load() *Config {
 		Debug:       debug,
 		AdminID:     adminID,
 		WebhookPort: webhookPort,
+
+		AllowLegacyReferrals: allowLegacyReferrals,
+
+		DefaultTimezone: defaultTimezone,
+		QuietHoursStart: getEnvHour("QUIET_HOURS_START", 22),
+		QuietHoursEnd:   getEnvHour("QUIET_HOURS_END", 8),
+
+		NotifyBatchSize:   getEnvInt("NOTIFY_BATCH_SIZE", 20),
+		NotifyConcurrency: getEnvInt("NOTIFY_CONCURRENCY", 4),
+		SendRateGlobal:    getEnvFloat("SEND_RATE_GLOBAL", 25),
+		SendRatePerChat:   getEnvFloat("SEND_RATE_PER_CHAT", 1),
+		NotifyMaxAttempts: getEnvInt("NOTIFY_MAX_ATTEMPTS", 5),
+
+		NotifyLeaseTTL: time.Duration(getEnvInt("NOTIFY_LEASE_SECONDS", 300)) * time.Second,
+
+		// Docker sends SIGKILL 10s after SIGTERM by default
+		ShutdownTimeout: time.Duration(getEnvInt("SHUTDOWN_TIMEOUT_SECONDS", 8)) * time.Second,
+
+		UpdateMode:            updateMode,
+		TelegramWebhookURL:    os.Getenv("TELEGRAM_WEBHOOK_URL"),
+		TelegramWebhookPath:   telegramWebhookPath,
+		TelegramWebhookSecret: os.Getenv("TELEGRAM_WEBHOOK_SECRET"),
+		TelegramWebhookListen: os.Getenv("TELEGRAM_WEBHOOK_LISTEN"),
+		TelegramWebhookCert:   os.Getenv("TELEGRAM_WEBHOOK_CERT"),
+		TelegramWebhookKey:    os.Getenv("TELEGRAM_WEBHOOK_KEY"),
+
+		WebhookMaxSkew:              time.Duration(getEnvInt("WEBHOOK_MAX_SKEW_SECONDS", 300)) * time.Second,
+		WebhookAllowLegacySecret:    os.Getenv("WEBHOOK_ALLOW_LEGACY_SECRET") == "true",
+		WebhookAllowUnauthenticated: os.Getenv("WEBHOOK_ALLOW_UNAUTHENTICATED") == "true",
+		WebhookIdempotencyTTL:       time.Duration(getEnvInt("WEBHOOK_IDEMPOTENCY_TTL_SECONDS", 86400)) * time.Second,
+		WebhookBatchMaxEvents:       getEnvInt("WEBHOOK_BATCH_MAX_EVENTS", 500),
+
+		LeaderboardThrottle: time.Duration(getEnvInt("LEADERBOARD_THROTTLE_MINUTES", 180)) * time.Minute,
+
+		ReminderTemplatesDir:  os.Getenv("REMINDER_TEMPLATES_DIR"),
+		ReminderTemplatesPoll: time.Duration(getEnvInt("REMINDER_TEMPLATES_POLL_SECONDS", 10)) * time.Second,
+		ExperimentsFile:       os.Getenv("EXPERIMENTS_FILE"),
+
+		OutboxPath:      outboxPath,
+		OutboxQueueSize: getEnvInt("OUTBOX_QUEUE_SIZE", 1000),
+		OutboxWorkers:   getEnvInt("OUTBOX_WORKERS", 4),
 	}
 
 	if cfg.BotToken == "" {
 		log.Fatal("BOT_TOKEN is required")
 	}
 
+	switch cfg.UpdateMode {
+	case UpdateModePolling:
+	case UpdateModeWebhook:
+		if cfg.TelegramWebhookURL == "" {
+			log.Fatal("TELEGRAM_WEBHOOK_URL is required when UPDATE_MODE=webhook")
+		}
+		if cfg.TelegramWebhookSecret == "" {
+			log.Fatal("TELEGRAM_WEBHOOK_SECRET is required when UPDATE_MODE=webhook")
+		}
+	default:
+		log.Fatalf("Unknown UPDATE_MODE %q (use %q or %q)", cfg.UpdateMode, UpdateModePolling, UpdateModeWebhook)
+	}
+
 	if cfg.ServerURL == "" {
 		cfg.ServerURL = "http://localhost:8081"
 	}
@@ -59,3 +189,48 @@ func Load() *Config {
 
 	return cfg
 }
+
+// getEnvHour reads an hour of day (0-23) from the environment
+func getEnvHour(key string, fallback int) int {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+
+	hour, err := strconv.Atoi(value)
+	if err != nil || hour < 0 || hour > 23 {
+		log.Printf("⚠️  Invalid %s %q, using %d", key, value, fallback)
+		return fallback
+	}
+	return hour
+}
+
+// getEnvInt reads a positive integer from the environment
+func getEnvInt(key string, fallback int) int {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+
+	n, err := strconv.Atoi(value)
+	if err != nil || n <= 0 {
+		log.Printf("⚠️  Invalid %s %q, using %d", key, value, fallback)
+		return fallback
+	}
+	return n
+}
+
+// getEnvFloat reads a positive number from the environment
+func getEnvFloat(key string, fallback float64) float64 {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil || f <= 0 {
+		log.Printf("⚠️  Invalid %s %q, using %g", key, value, fallback)
+		return fallback
+	}
+	return f
+}
@@ -0,0 +1,160 @@
+// Package experiments assigns users to the arms of A/B tests on notification copy.
+//
+// Experiments are read from a JSON file:
+//
+//	{
+//	  "experiments": [
+//	    {
+//	      "name": "streak-copy-1",
+//	      "kind": "streak",
+//	      "arms": [
+//	        {"variant": "system_breach", "weight": 2},
+//	        {"variant": "surveillance", "weight": 1}
+//	      ]
+//	    }
+//	  ]
+//	}
+//
+// A user's arm depends only on their Telegram ID and the experiment name, so it is
+// the same on every replica and every day without storing anything. Weights are
+// relative: above, two thirds of users get "system_breach".
+package experiments
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+)
+
+// Arm is one variant under test
+type Arm struct {
+	Variant string `json:"variant"` // reminder template ID sent to users in this arm
+	Weight  int    `json:"weight"`  // share of users, relative to the other arms
+}
+
+// Experiment splits the users who get one kind of reminder between arms
+type Experiment struct {
+	Name string `json:"name"` // reported with every send; renaming it reshuffles users
+	Kind string `json:"kind"` // reminder kind the experiment applies to, e.g. "streak"
+	Arms []Arm  `json:"arms"`
+}
+
+// Set is the experiments loaded from a file. A nil Set has no experiments.
+type Set struct {
+	byKind map[string]Experiment
+}
+
+// file is the on-disk format
+type file struct {
+	Experiments []Experiment `json:"experiments"`
+}
+
+// Load reads and validates the experiments file. An empty path means no experiments.
+func Load(path string) (*Set, error) {
+	if path == "" {
+		return nil, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var f file
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	set, err := newSet(f.Experiments)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return set, nil
+}
+
+// newSet validates experiments and indexes them by kind
+func newSet(experiments []Experiment) (*Set, error) {
+	set := &Set{byKind: make(map[string]Experiment)}
+	names := make(map[string]bool)
+
+	for _, e := range experiments {
+		switch {
+		case e.Name == "":
+			return nil, fmt.Errorf("experiment without a name")
+		case names[e.Name]:
+			return nil, fmt.Errorf("experiment %q: duplicate name", e.Name)
+		case e.Kind == "":
+			return nil, fmt.Errorf("experiment %q: missing kind", e.Name)
+		case len(e.Arms) == 0:
+			return nil, fmt.Errorf("experiment %q: no arms", e.Name)
+		}
+		// Two experiments on the same messages would compete for the same users
+		if other, ok := set.byKind[e.Kind]; ok {
+			return nil, fmt.Errorf("experiment %q: %q already runs on %s reminders", e.Name, other.Name, e.Kind)
+		}
+
+		variants := make(map[string]bool)
+		for _, arm := range e.Arms {
+			switch {
+			case arm.Variant == "":
+				return nil, fmt.Errorf("experiment %q: arm without a variant", e.Name)
+			case variants[arm.Variant]:
+				return nil, fmt.Errorf("experiment %q: variant %q is in two arms", e.Name, arm.Variant)
+			case arm.Weight <= 0:
+				return nil, fmt.Errorf("experiment %q: variant %q needs a positive weight", e.Name, arm.Variant)
+			}
+			variants[arm.Variant] = true
+		}
+
+		names[e.Name] = true
+		set.byKind[e.Kind] = e
+	}
+	return set, nil
+}
+
+// All returns every experiment, in no particular order
+func (s *Set) All() []Experiment {
+	if s == nil {
+		return nil
+	}
+	all := make([]Experiment, 0, len(s.byKind))
+	for _, e := range s.byKind {
+		all = append(all, e)
+	}
+	return all
+}
+
+// Assign returns the experiment running on a kind of reminder and the user's arm in it
+func (s *Set) Assign(kind string, telegramID int64) (Experiment, Arm, bool) {
+	if s == nil {
+		return Experiment{}, Arm{}, false
+	}
+	e, ok := s.byKind[kind]
+	if !ok {
+		return Experiment{}, Arm{}, false
+	}
+	return e, e.Assign(telegramID), true
+}
+
+// Assign picks the user's arm by hashing their Telegram ID with the experiment name,
+// so the same users don't end up together in the first arm of every experiment
+func (e Experiment) Assign(telegramID int64) Arm {
+	total := 0
+	for _, arm := range e.Arms {
+		total += arm.Weight
+	}
+
+	// A modulo keeps only the low bits, so they must depend on the whole input; FNV's don't
+	sum := sha256.Sum256([]byte(e.Name + "\x00" + strconv.FormatInt(telegramID, 10)))
+	bucket := int(binary.BigEndian.Uint64(sum[:8]) % uint64(total))
+
+	for _, arm := range e.Arms {
+		if bucket < arm.Weight {
+			return arm
+		}
+		bucket -= arm.Weight
+	}
+	return e.Arms[len(e.Arms)-1]
+}
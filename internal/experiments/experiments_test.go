@@ -0,0 +1,107 @@
+package experiments
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestAssignIsDeterministicAndWeighted(t *testing.T) {
+	e := Experiment{Name: "streak-copy-1", Kind: "streak", Arms: []Arm{
+		{Variant: "system_breach", Weight: 3},
+		{Variant: "surveillance", Weight: 1},
+	}}
+
+	const users = 20000
+	counts := make(map[string]int)
+	for id := int64(1); id <= users; id++ {
+		arm := e.Assign(id)
+		if again := e.Assign(id); again != arm {
+			t.Fatalf("User %d got %s, then %s", id, arm.Variant, again.Variant)
+		}
+		counts[arm.Variant]++
+	}
+
+	if share := float64(counts["system_breach"]) / users; math.Abs(share-0.75) > 0.02 {
+		t.Errorf("Expected about 75%% in the heavier arm, got %.1f%%", share*100)
+	}
+}
+
+func TestExperimentsAreIndependent(t *testing.T) {
+	arms := []Arm{{Variant: "a", Weight: 1}, {Variant: "b", Weight: 1}}
+	first := Experiment{Name: "first", Arms: arms}
+	second := Experiment{Name: "second", Arms: arms}
+
+	const users = 20000
+	same := 0
+	for id := int64(1); id <= users; id++ {
+		if first.Assign(id) == second.Assign(id) {
+			same++
+		}
+	}
+	// Independent 50/50 splits put about half the users in matching arms
+	if share := float64(same) / users; math.Abs(share-0.5) > 0.02 {
+		t.Errorf("Expected about 50%% of users in matching arms, got %.1f%%", share*100)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	if set, err := Load(""); err != nil || set != nil {
+		t.Errorf("Expected no experiments without a file, got %v (%v)", set, err)
+	}
+
+	path := filepath.Join(t.TempDir(), "experiments.json")
+	os.WriteFile(path, []byte(`{"experiments": [{"name": "copy", "kind": "streak", "arms": [{"variant": "a", "weight": 1}]}]}`), 0o644)
+
+	set, err := Load(path)
+	if err != nil {
+		t.Fatalf("Failed to load: %v", err)
+	}
+	e, arm, ok := set.Assign("streak", 42)
+	if !ok || e.Name != "copy" || arm.Variant != "a" {
+		t.Errorf("Expected arm a of copy, got %q of %q (%v)", arm.Variant, e.Name, ok)
+	}
+	if _, _, ok := set.Assign("no_streak", 42); ok {
+		t.Error("Expected no experiment on no_streak reminders")
+	}
+
+	var none *Set
+	if _, _, ok := none.Assign("streak", 42); ok {
+		t.Error("Expected a nil set to assign nothing")
+	}
+}
+
+func TestInvalidExperimentsAreRejected(t *testing.T) {
+	arms := `[{"variant": "a", "weight": 1}]`
+	tests := []struct {
+		name string
+		json string
+		want string
+	}{
+		{"malformed", `{"experiments": [`, "unexpected end"},
+		{"no name", `{"experiments": [{"kind": "streak", "arms": ` + arms + `}]}`, "without a name"},
+		{"no kind", `{"experiments": [{"name": "x", "arms": ` + arms + `}]}`, "missing kind"},
+		{"no arms", `{"experiments": [{"name": "x", "kind": "streak"}]}`, "no arms"},
+		{"zero weight", `{"experiments": [{"name": "x", "kind": "streak", "arms": [{"variant": "a"}]}]}`, "positive weight"},
+		{"duplicate variant", `{"experiments": [{"name": "x", "kind": "streak", "arms": [{"variant": "a", "weight": 1}, {"variant": "a", "weight": 2}]}]}`, "in two arms"},
+		{"duplicate name", `{"experiments": [{"name": "x", "kind": "streak", "arms": ` + arms + `}, {"name": "x", "kind": "no_streak", "arms": ` + arms + `}]}`, "duplicate name"},
+		{"same kind", `{"experiments": [{"name": "x", "kind": "streak", "arms": ` + arms + `}, {"name": "y", "kind": "streak", "arms": ` + arms + `}]}`, "already runs"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "experiments.json")
+			os.WriteFile(path, []byte(tt.json), 0o644)
+
+			_, err := Load(path)
+			if err == nil {
+				t.Fatal("Expected an error, got none")
+			}
+			if !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Expected an error mentioning %q, got %v", tt.want, err)
+			}
+		})
+	}
+}
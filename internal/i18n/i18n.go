@@ -0,0 +1,192 @@
+// Package i18n holds the bot's message catalogs and picks one for a user.
+//
+// Catalogs live in locales/<lang>.json and are embedded in the binary. Each key maps to
+// a message, a list of alternatives the caller picks from, or plural forms keyed by
+// CLDR category ("one", "few", "many", "other"). Messages are fmt templates that use
+// indexed verbs (%[1]s) so translations can reorder arguments. Keys missing from a
+// catalog fall back to English.
+package i18n
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"log"
+	"path"
+	"sort"
+	"strings"
+)
+
+// DefaultLanguage is used when no supported language matches and for missing keys
+const DefaultLanguage = "en"
+
+//go:embed locales/*.json
+var files embed.FS
+
+// entry is one catalog key: exactly one of the fields is set
+type entry struct {
+	text         string
+	alternatives []string
+	plural       map[string]string
+}
+
+// UnmarshalJSON accepts a string, a list of strings or an object of plural forms
+func (e *entry) UnmarshalJSON(data []byte) error {
+	switch {
+	case json.Unmarshal(data, &e.text) == nil:
+	case json.Unmarshal(data, &e.alternatives) == nil:
+		if len(e.alternatives) == 0 {
+			return fmt.Errorf("empty list of alternatives")
+		}
+	case json.Unmarshal(data, &e.plural) == nil:
+		if _, ok := e.plural["other"]; !ok {
+			return fmt.Errorf("plural forms without \"other\"")
+		}
+	default:
+		return fmt.Errorf("expected a string, a list or plural forms")
+	}
+	return nil
+}
+
+// Catalog is the set of messages for one language
+type Catalog struct {
+	lang     string
+	entries  map[string]entry
+	plural   pluralRule
+	fallback *Catalog
+}
+
+var catalogs = mustLoad()
+
+// mustLoad parses the embedded catalogs. A malformed catalog is a build mistake, so it panics.
+func mustLoad() map[string]*Catalog {
+	names, err := files.ReadDir("locales")
+	if err != nil {
+		panic(err)
+	}
+
+	loaded := make(map[string]*Catalog)
+	for _, f := range names {
+		lang := strings.TrimSuffix(f.Name(), path.Ext(f.Name()))
+		data, err := files.ReadFile("locales/" + f.Name())
+		if err != nil {
+			panic(err)
+		}
+
+		var entries map[string]entry
+		if err := json.Unmarshal(data, &entries); err != nil {
+			panic(fmt.Sprintf("i18n: invalid catalog %s: %v", f.Name(), err))
+		}
+		loaded[lang] = &Catalog{lang: lang, entries: entries, plural: pluralRuleFor(lang)}
+	}
+
+	def, ok := loaded[DefaultLanguage]
+	if !ok {
+		panic("i18n: missing catalog for " + DefaultLanguage)
+	}
+	for lang, c := range loaded {
+		if lang != DefaultLanguage {
+			c.fallback = def
+		}
+	}
+	return loaded
+}
+
+// Supported returns the languages with a catalog, sorted
+func Supported() []string {
+	langs := make([]string, 0, len(catalogs))
+	for lang := range catalogs {
+		langs = append(langs, lang)
+	}
+	sort.Strings(langs)
+	return langs
+}
+
+// Default returns the English catalog
+func Default() *Catalog {
+	return catalogs[DefaultLanguage]
+}
+
+// Lookup returns the catalog for a language code, matching regional codes like
+// "pl-PL" or "pt_BR" by their base language
+func Lookup(languageCode string) (*Catalog, bool) {
+	code := strings.ToLower(strings.ReplaceAll(languageCode, "_", "-"))
+	if c, ok := catalogs[code]; ok {
+		return c, true
+	}
+	if base, _, found := strings.Cut(code, "-"); found {
+		c, ok := catalogs[base]
+		return c, ok
+	}
+	return nil, false
+}
+
+// Resolve returns the catalog for the first supported language code, in order of
+// preference (e.g. the user's explicit choice, then Telegram's language_code),
+// or the default catalog when none is supported
+func Resolve(languageCodes ...string) *Catalog {
+	for _, code := range languageCodes {
+		if c, ok := Lookup(code); ok {
+			return c
+		}
+	}
+	return Default()
+}
+
+// Lang returns the catalog's language code
+func (c *Catalog) Lang() string {
+	return c.lang
+}
+
+// lookup finds a key in this catalog or its fallback
+func (c *Catalog) lookup(key string) (entry, bool) {
+	for cat := c; cat != nil; cat = cat.fallback {
+		if e, ok := cat.entries[key]; ok {
+			return e, true
+		}
+	}
+	log.Printf("[I18N] Missing message %q for %s", key, c.lang)
+	return entry{}, false
+}
+
+// Text returns the message for key, or the key itself when no catalog has it
+func (c *Catalog) Text(key string) string {
+	e, ok := c.lookup(key)
+	switch {
+	case !ok:
+		return key
+	case e.text != "":
+		return e.text
+	case len(e.alternatives) > 0:
+		return e.alternatives[0]
+	default:
+		return e.plural["other"]
+	}
+}
+
+// Alternatives returns every variant of a message the caller can choose from.
+// A plain message is a single alternative.
+func (c *Catalog) Alternatives(key string) []string {
+	e, ok := c.lookup(key)
+	if ok && len(e.alternatives) > 0 {
+		return e.alternatives
+	}
+	return []string{c.Text(key)}
+}
+
+// Plural formats n with the plural form of key for this language, e.g. "5 дней"
+func (c *Catalog) Plural(key string, n int) string {
+	for cat := c; cat != nil; cat = cat.fallback {
+		e, ok := cat.entries[key]
+		if !ok || e.plural == nil {
+			continue
+		}
+		form, ok := e.plural[cat.plural(n)]
+		if !ok {
+			form = e.plural["other"]
+		}
+		return fmt.Sprintf(form, n)
+	}
+	log.Printf("[I18N] Missing plural %q for %s", key, c.lang)
+	return fmt.Sprintf("%d %s", n, key)
+}
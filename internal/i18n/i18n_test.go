@@ -0,0 +1,151 @@
+package i18n
+
+import (
+	"regexp"
+	"testing"
+)
+
+func TestPluralRules(t *testing.T) {
+	tests := []struct {
+		lang string
+		n    int
+		want string
+	}{
+		{"en", 0, "0 days"},
+		{"en", 1, "1 day"},
+		{"en", 21, "21 days"},
+		{"ru", 1, "1 день"},
+		{"ru", 3, "3 дня"},
+		{"ru", 5, "5 дней"},
+		{"ru", 11, "11 дней"},
+		{"ru", 14, "14 дней"},
+		{"ru", 21, "21 день"},
+		{"ru", 22, "22 дня"},
+		{"ru", 111, "111 дней"},
+		{"pl", 1, "1 dzień"},
+		{"pl", 2, "2 dni"},
+		{"pl", 5, "5 dni"},
+		{"pl", 22, "22 dni"},
+	}
+
+	for _, tt := range tests {
+		if got := Resolve(tt.lang).Plural("days", tt.n); got != tt.want {
+			t.Errorf("%s Plural(days, %d): expected %q, got %q", tt.lang, tt.n, tt.want, got)
+		}
+	}
+
+	hours := []struct {
+		n    int
+		want string
+	}{
+		{1, "1 godzinę temu"},
+		{3, "3 godziny temu"},
+		{12, "12 godzin temu"},
+		{21, "21 godzin temu"},
+		{24, "24 godziny temu"},
+	}
+	for _, tt := range hours {
+		if got := Resolve("pl").Plural("last_played.hours", tt.n); got != tt.want {
+			t.Errorf("pl Plural(last_played.hours, %d): expected %q, got %q", tt.n, tt.want, got)
+		}
+	}
+}
+
+func TestResolve(t *testing.T) {
+	tests := []struct {
+		name  string
+		codes []string
+		want  string
+	}{
+		{"exact", []string{"ru"}, "ru"},
+		{"regional", []string{"pl-PL"}, "pl"},
+		{"underscore and case", []string{"RU_ru"}, "ru"},
+		{"override wins", []string{"pl", "ru"}, "pl"},
+		{"unsupported override", []string{"de", "ru"}, "ru"},
+		{"empty override", []string{"", "pl"}, "pl"},
+		{"unsupported", []string{"fr"}, DefaultLanguage},
+		{"nothing", nil, DefaultLanguage},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Resolve(tt.codes...).Lang(); got != tt.want {
+				t.Errorf("Expected %s, got %s", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestMissingKeyFallsBackToEnglish(t *testing.T) {
+	ru := Resolve("ru")
+	delete(ru.entries, "agent")
+	defer func() { ru.entries["agent"] = entry{text: "Агент"} }()
+
+	if got := ru.Text("agent"); got != "Agent" {
+		t.Errorf("Expected the English text, got %q", got)
+	}
+	if got := ru.Text("no.such.key"); got != "no.such.key" {
+		t.Errorf("Expected the key for an unknown message, got %q", got)
+	}
+}
+
+// verb matches a formatting directive with an explicit argument index
+var verb = regexp.MustCompile(`%[-+# 0-9]*\[(\d+)\]([a-zA-Z])`)
+
+// unindexed matches a directive without an index, which would break reordering
+var unindexed = regexp.MustCompile(`%[-+# 0-9]*[a-zA-Z]`)
+
+// verbs returns the indexed directives used by templates, e.g. {"1s", "2d"}
+func verbs(templates ...string) map[string]bool {
+	set := make(map[string]bool)
+	for _, tmpl := range templates {
+		for _, m := range verb.FindAllStringSubmatch(tmpl, -1) {
+			set[m[1]+m[2]] = true
+		}
+	}
+	return set
+}
+
+func TestCatalogsMatchEnglish(t *testing.T) {
+	en := Default()
+
+	for _, lang := range Supported() {
+		c := catalogs[lang]
+		for key, e := range c.entries {
+			base, ok := en.entries[key]
+			if !ok {
+				t.Errorf("%s: key %q is not in the English catalog", lang, key)
+				continue
+			}
+
+			switch {
+			case e.plural != nil:
+				if base.plural == nil {
+					t.Errorf("%s: %q has plural forms, English doesn't", lang, key)
+				}
+				continue
+			case (e.alternatives == nil) != (base.alternatives == nil):
+				t.Errorf("%s: %q is a list in only one of the catalogs", lang, key)
+				continue
+			}
+
+			templates := append([]string{e.text}, e.alternatives...)
+			allowed := verbs(base.text)
+			for _, alt := range base.alternatives {
+				for v := range verbs(alt) {
+					allowed[v] = true
+				}
+			}
+			for v := range verbs(templates...) {
+				if !allowed[v] {
+					t.Errorf("%s: %q uses argument %%[%s], which English doesn't pass", lang, key, v)
+				}
+			}
+			for _, tmpl := range templates {
+				if m := unindexed.FindString(tmpl); m != "" {
+					t.Errorf("%s: %q uses %s without an argument index", lang, key, m)
+				}
+			}
+		}
+	}
+}
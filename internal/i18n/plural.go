@@ -0,0 +1,59 @@
+package i18n
+
+// pluralRule returns the CLDR plural category of n for a language
+type pluralRule func(n int) string
+
+// pluralRules covers the languages with a catalog; others use the English rule
+var pluralRules = map[string]pluralRule{
+	"en": pluralEnglish,
+	"ru": pluralEastSlavic,
+	"uk": pluralEastSlavic,
+	"pl": pluralPolish,
+}
+
+func pluralRuleFor(lang string) pluralRule {
+	if rule, ok := pluralRules[lang]; ok {
+		return rule
+	}
+	return pluralEnglish
+}
+
+// pluralEnglish: 1 day, 2 days
+func pluralEnglish(n int) string {
+	if n == 1 {
+		return "one"
+	}
+	return "other"
+}
+
+// pluralEastSlavic: 1/21 день, 2-4/22-24 дня, 5-20/25 дней
+func pluralEastSlavic(n int) string {
+	if n < 0 {
+		n = -n
+	}
+	mod10, mod100 := n%10, n%100
+	switch {
+	case mod10 == 1 && mod100 != 11:
+		return "one"
+	case mod10 >= 2 && mod10 <= 4 && (mod100 < 12 || mod100 > 14):
+		return "few"
+	default:
+		return "many"
+	}
+}
+
+// pluralPolish: 1 godzina, 2-4/22-24 godziny, 5-21/25 godzin
+func pluralPolish(n int) string {
+	if n < 0 {
+		n = -n
+	}
+	mod10, mod100 := n%10, n%100
+	switch {
+	case n == 1:
+		return "one"
+	case mod10 >= 2 && mod10 <= 4 && (mod100 < 12 || mod100 > 14):
+		return "few"
+	default:
+		return "many"
+	}
+}
@@ -9,6 +9,8 @@ type User struct {
 	HexStreak     int    `json:"hex_streak"`
 	WordStreak    int    `json:"word_streak"`
 	NumericStreak int    `json:"numeric_streak"`
+	Timezone      string `json:"timezone,omitempty"`      // IANA zone, e.g. Europe/Warsaw
+	LanguageCode  string `json:"language_code,omitempty"` // Preferred language, e.g. pl
 }
 
 type UserProfile struct {
@@ -21,6 +23,7 @@ type UserProfile struct {
 	ReferralCount int    `json:"referral_count"`
 	DailyStreak   int    `json:"daily_streak"`
 	LastPlayedAt  string `json:"last_played_at"`
+	LanguageCode  string `json:"language_code,omitempty"`
 }
 
 type ReferralRequest struct {
@@ -34,6 +37,18 @@ type ReferralResponse struct {
 	Message       string `json:"message"`
 }
 
+type TimezoneRequest struct {
+	Timezone string `json:"timezone"`
+}
+
+type LanguageRequest struct {
+	LanguageCode string `json:"language_code"`
+}
+
+type UnreachableRequest struct {
+	Reason string `json:"reason"`
+}
+
 type UserStats struct {
 	TotalUsers    int `json:"total_users"`
 	ActiveUsers7d int `json:"active_users_7d"`
@@ -0,0 +1,132 @@
+package outbox
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"time"
+)
+
+// Journal record operations
+const (
+	opEnqueue = "enqueue"
+	opDone    = "done"
+)
+
+// maxRecordSize bounds a single journal line; Telegram messages are at most 4096 characters
+const maxRecordSize = 1 << 20
+
+// record is one line of the append-only journal
+type record struct {
+	Op        string    `json:"op"`
+	Message   *Message  `json:"message,omitempty"`
+	ID        string    `json:"id,omitempty"`
+	Delivered bool      `json:"delivered,omitempty"`
+	At        time.Time `json:"at,omitempty"`
+}
+
+// readJournal rebuilds the outbox state: messages enqueued but never finished, in
+// enqueue order, and IDs delivered after cutoff. A missing journal is an empty one.
+func readJournal(path string, cutoff time.Time) ([]Message, map[string]time.Time, error) {
+	delivered := make(map[string]time.Time)
+
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, delivered, nil
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open journal: %w", err)
+	}
+	defer f.Close()
+
+	pending := make(map[string]Message)
+	var order []string
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), maxRecordSize)
+	for line := 1; scanner.Scan(); line++ {
+		var rec record
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			// A crash mid-write leaves a torn last line; the message it described was never acknowledged
+			log.Printf("[OUTBOX] Skipping unreadable journal line %d: %v", line, err)
+			continue
+		}
+
+		switch rec.Op {
+		case opEnqueue:
+			if rec.Message == nil {
+				continue
+			}
+			if _, ok := pending[rec.Message.ID]; !ok {
+				order = append(order, rec.Message.ID)
+			}
+			pending[rec.Message.ID] = *rec.Message
+		case opDone:
+			delete(pending, rec.ID)
+			if rec.Delivered && rec.At.After(cutoff) {
+				delivered[rec.ID] = rec.At
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, nil, fmt.Errorf("failed to read journal: %w", err)
+	}
+
+	messages := make([]Message, 0, len(pending))
+	for _, id := range order {
+		if msg, ok := pending[id]; ok {
+			messages = append(messages, msg)
+			delete(pending, id)
+		}
+	}
+	return messages, delivered, nil
+}
+
+// writeJournal atomically replaces the journal with the given state
+func writeJournal(path string, pending []Message, delivered map[string]time.Time) error {
+	tmp := path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to create journal: %w", err)
+	}
+
+	w := bufio.NewWriter(f)
+	enc := json.NewEncoder(w)
+
+	sort.Slice(pending, func(i, j int) bool {
+		return pending[i].CreatedAt.Before(pending[j].CreatedAt)
+	})
+	for i := range pending {
+		if err := enc.Encode(record{Op: opEnqueue, Message: &pending[i]}); err != nil {
+			f.Close()
+			return fmt.Errorf("failed to write journal: %w", err)
+		}
+	}
+	for id, at := range delivered {
+		if err := enc.Encode(record{Op: opDone, ID: id, Delivered: true, At: at}); err != nil {
+			f.Close()
+			return fmt.Errorf("failed to write journal: %w", err)
+		}
+	}
+
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write journal: %w", err)
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to sync journal: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("failed to close journal: %w", err)
+	}
+
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("failed to replace journal: %w", err)
+	}
+	return nil
+}
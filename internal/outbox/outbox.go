@@ -0,0 +1,429 @@
+package outbox
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"decodeBot/internal/sender"
+
+	tele "gopkg.in/telebot.v4"
+)
+
+const (
+	DefaultQueueSize = 1000
+	DefaultWorkers   = 4
+
+	// sendTimeout bounds a single send, including rate-limit waits
+	sendTimeout = 30 * time.Second
+	// deliveredTTL is how long delivered message IDs are remembered for deduplication
+	deliveredTTL = 24 * time.Hour
+	// compactEvery is the number of finished sends between journal compactions
+	compactEvery = 1000
+)
+
+var (
+	// ErrFull is returned when too many messages are waiting to be sent
+	ErrFull = errors.New("outbox is full")
+	// ErrClosed is returned when enqueueing after Close
+	ErrClosed = errors.New("outbox is closed")
+	// ErrInterrupted is reported for messages still unsent at shutdown; they stay
+	// in the journal and are sent on the next start
+	ErrInterrupted = errors.New("send interrupted by shutdown")
+	// ErrExpired is reported for messages that couldn't be sent before their ExpiresAt
+	ErrExpired = errors.New("message expired before it could be sent")
+)
+
+// Message is an outgoing Telegram message as stored in the journal
+type Message struct {
+	// ID deduplicates sends: a message whose ID was delivered recently is not sent again
+	ID             string            `json:"id"`
+	ChatID         int64             `json:"chat_id"`
+	Text           string            `json:"text"`
+	ParseMode      tele.ParseMode    `json:"parse_mode,omitempty"`
+	Markup         *tele.ReplyMarkup `json:"markup,omitempty"`
+	DisablePreview bool              `json:"disable_preview,omitempty"`
+	CreatedAt      time.Time         `json:"created_at"`
+	// ExpiresAt, if set, drops the message instead of sending it late, e.g. once a job lease lapses
+	ExpiresAt time.Time `json:"expires_at,omitempty"`
+}
+
+// Options configures the outbox
+type Options struct {
+	QueueSize int // messages waiting for a worker before Enqueue returns ErrFull
+	Workers   int // parallel send workers
+}
+
+// entry is a message that was journaled but not yet sent
+type entry struct {
+	msg     Message
+	waiters []func(error)
+}
+
+// Outbox persists outgoing messages to an append-only journal before sending them,
+// so messages accepted before a crash or restart are sent once the bot is back.
+//
+// Delivery is at least once: a crash between a send and its journal record
+// sends the message again on the next start.
+type Outbox struct {
+	sender *sender.Sender
+	path   string
+
+	mu        sync.Mutex
+	journal   *os.File
+	pending   map[string]*entry
+	delivered map[string]time.Time
+	finished  int // sends finished since the last compaction
+	closed    bool
+	drained   chan struct{} // closed once pending empties after Close
+
+	queue  chan string
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// Open loads the journal at path, compacts it and starts sending,
+// beginning with messages left over from the previous run
+func Open(path string, sender *sender.Sender, opts Options) (*Outbox, error) {
+	if opts.QueueSize <= 0 {
+		opts.QueueSize = DefaultQueueSize
+	}
+	if opts.Workers <= 0 {
+		opts.Workers = DefaultWorkers
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create outbox directory: %w", err)
+	}
+
+	leftover, delivered, err := readJournal(path, time.Now().Add(-deliveredTTL))
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	o := &Outbox{
+		sender:    sender,
+		path:      path,
+		pending:   make(map[string]*entry),
+		delivered: delivered,
+		queue:     make(chan string, opts.QueueSize),
+		ctx:       ctx,
+		cancel:    cancel,
+	}
+	for _, msg := range leftover {
+		o.pending[msg.ID] = &entry{msg: msg}
+	}
+
+	// Start every run from a compact journal so restarts don't grow it
+	if err := o.compactLocked(); err != nil {
+		cancel()
+		return nil, err
+	}
+
+	for i := 0; i < opts.Workers; i++ {
+		o.wg.Add(1)
+		go o.worker()
+	}
+
+	if len(leftover) > 0 {
+		log.Printf("[OUTBOX] Replaying %d unsent messages from %s", len(leftover), path)
+		o.wg.Add(1)
+		go o.replay(leftover)
+	}
+
+	return o, nil
+}
+
+// Enqueue journals the message and queues it for sending without blocking.
+// done, if not nil, is called with the send result; a message whose ID is already
+// pending or was delivered recently is not sent again.
+//
+// Failed sends are not retried; retrying is up to the caller.
+func (o *Outbox) Enqueue(msg Message, done func(error)) error {
+	if msg.ID == "" {
+		msg.ID = newID()
+	}
+	if msg.CreatedAt.IsZero() {
+		msg.CreatedAt = time.Now()
+	}
+
+	o.mu.Lock()
+
+	if o.closed {
+		o.mu.Unlock()
+		return ErrClosed
+	}
+
+	if _, ok := o.delivered[msg.ID]; ok {
+		o.mu.Unlock()
+		if done != nil {
+			done(nil)
+		}
+		return nil
+	}
+
+	if e, ok := o.pending[msg.ID]; ok {
+		if done != nil {
+			e.waiters = append(e.waiters, done)
+		}
+		o.mu.Unlock()
+		return nil
+	}
+
+	// Workers look the message up under the lock, so it's journaled before any of them sees it
+	select {
+	case o.queue <- msg.ID:
+	default:
+		o.mu.Unlock()
+		return ErrFull
+	}
+
+	if err := o.append(record{Op: opEnqueue, Message: &msg}, true); err != nil {
+		o.mu.Unlock()
+		return fmt.Errorf("failed to journal message: %w", err)
+	}
+
+	e := &entry{msg: msg}
+	if done != nil {
+		e.waiters = append(e.waiters, done)
+	}
+	o.pending[msg.ID] = e
+	o.mu.Unlock()
+	return nil
+}
+
+// Send enqueues the message and waits for the send result.
+// If ctx ends first the message stays queued and is still sent.
+func (o *Outbox) Send(ctx context.Context, msg Message) error {
+	result := make(chan error, 1)
+	if err := o.Enqueue(msg, func(err error) { result <- err }); err != nil {
+		return err
+	}
+
+	select {
+	case err := <-result:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Close stops accepting messages and waits for queued ones to be sent until ctx
+// expires. Whatever is left stays in the journal for the next start.
+func (o *Outbox) Close(ctx context.Context) error {
+	o.mu.Lock()
+	if o.closed {
+		o.mu.Unlock()
+		return nil
+	}
+	o.closed = true
+	drained := make(chan struct{})
+	if len(o.pending) == 0 {
+		close(drained)
+	} else {
+		o.drained = drained
+	}
+	o.mu.Unlock()
+
+	var err error
+	select {
+	case <-drained:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	o.cancel()
+	o.wg.Wait()
+
+	o.mu.Lock()
+	var waiters []func(error)
+	for _, e := range o.pending {
+		waiters = append(waiters, e.waiters...)
+		e.waiters = nil
+	}
+	if n := len(o.pending); n > 0 {
+		log.Printf("[OUTBOX] %d unsent messages kept for the next start", n)
+	}
+	if cerr := o.journal.Close(); cerr != nil && err == nil {
+		err = cerr
+	}
+	o.mu.Unlock()
+
+	notify(waiters, ErrInterrupted)
+	return err
+}
+
+// replay queues messages left over from the previous run
+func (o *Outbox) replay(messages []Message) {
+	defer o.wg.Done()
+
+	for _, msg := range messages {
+		select {
+		case o.queue <- msg.ID:
+		case <-o.ctx.Done():
+			return
+		}
+	}
+}
+
+// worker sends queued messages until the outbox is closed
+func (o *Outbox) worker() {
+	defer o.wg.Done()
+
+	for {
+		select {
+		case id := <-o.queue:
+			o.deliver(id)
+		case <-o.ctx.Done():
+			return
+		}
+	}
+}
+
+// deliver sends one message and records the outcome
+func (o *Outbox) deliver(id string) {
+	o.mu.Lock()
+	e, ok := o.pending[id]
+	o.mu.Unlock()
+	if !ok {
+		// Journaling failed after the ID was queued
+		return
+	}
+
+	deadline := time.Now().Add(sendTimeout)
+	if !e.msg.ExpiresAt.IsZero() && e.msg.ExpiresAt.Before(deadline) {
+		deadline = e.msg.ExpiresAt
+	}
+	ctx, cancel := context.WithDeadline(o.ctx, deadline)
+	err := o.send(ctx, e.msg)
+	cancel()
+
+	if err != nil && o.ctx.Err() != nil {
+		// Aborted by Close: leave it journaled, Close notifies the waiters
+		return
+	}
+	if err != nil && !e.msg.ExpiresAt.IsZero() && !time.Now().Before(e.msg.ExpiresAt) {
+		err = ErrExpired
+	}
+
+	now := time.Now()
+
+	o.mu.Lock()
+	delete(o.pending, id)
+	if err == nil {
+		o.delivered[id] = now
+	}
+	if jerr := o.append(record{Op: opDone, ID: id, Delivered: err == nil, At: now}, false); jerr != nil {
+		log.Printf("[OUTBOX] Failed to journal outcome of %s: %v", id, jerr)
+	}
+
+	o.finished++
+	if o.finished >= compactEvery {
+		if cerr := o.compactLocked(); cerr != nil {
+			log.Printf("[OUTBOX] Compaction failed: %v", cerr)
+		}
+	}
+
+	if o.drained != nil && len(o.pending) == 0 {
+		close(o.drained)
+		o.drained = nil
+	}
+
+	waiters := e.waiters
+	e.waiters = nil
+	o.mu.Unlock()
+
+	if err != nil && len(waiters) == 0 {
+		// Replayed messages have nobody to report to
+		log.Printf("[OUTBOX] Failed to send %s to %d: %v", id, e.msg.ChatID, err)
+	}
+	notify(waiters, err)
+}
+
+// send delivers a message through the rate-limited sender
+func (o *Outbox) send(ctx context.Context, msg Message) error {
+	var opts []interface{}
+	if msg.ParseMode != "" {
+		opts = append(opts, msg.ParseMode)
+	}
+	if msg.Markup != nil {
+		opts = append(opts, msg.Markup)
+	}
+	if msg.DisablePreview {
+		opts = append(opts, tele.NoPreview)
+	}
+
+	_, err := o.sender.Send(ctx, &tele.User{ID: msg.ChatID}, msg.Text, opts...)
+	return err
+}
+
+// append writes a record to the journal, syncing it to disk if durable is set.
+// Callers hold o.mu.
+func (o *Outbox) append(rec record, durable bool) error {
+	line, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	if _, err := o.journal.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	if durable {
+		return o.journal.Sync()
+	}
+	return nil
+}
+
+// compactLocked rewrites the journal with only pending messages and recent
+// deliveries. Callers hold o.mu.
+func (o *Outbox) compactLocked() error {
+	cutoff := time.Now().Add(-deliveredTTL)
+	for id, at := range o.delivered {
+		if at.Before(cutoff) {
+			delete(o.delivered, id)
+		}
+	}
+
+	pending := make([]Message, 0, len(o.pending))
+	for _, e := range o.pending {
+		pending = append(pending, e.msg)
+	}
+
+	if err := writeJournal(o.path, pending, o.delivered); err != nil {
+		return err
+	}
+
+	if o.journal != nil {
+		o.journal.Close()
+	}
+	f, err := os.OpenFile(o.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to open journal: %w", err)
+	}
+	o.journal = f
+	o.finished = 0
+	return nil
+}
+
+// notify reports a send result to everyone waiting on it
+func notify(waiters []func(error), err error) {
+	for _, done := range waiters {
+		done(err)
+	}
+}
+
+// newID generates an ID for messages the caller didn't label
+func newID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,194 @@
+package outbox
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"decodeBot/internal/sender"
+
+	tele "gopkg.in/telebot.v4"
+)
+
+// fakeBot records sent texts, failing with err if set
+type fakeBot struct {
+	mu    sync.Mutex
+	texts []string
+	err   error
+}
+
+func (b *fakeBot) Send(to tele.Recipient, what interface{}, opts ...interface{}) (*tele.Message, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.err != nil {
+		return nil, b.err
+	}
+	b.texts = append(b.texts, what.(string))
+	return &tele.Message{}, nil
+}
+
+func (b *fakeBot) sent() []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]string(nil), b.texts...)
+}
+
+func openTestOutbox(t *testing.T, path string, bot sender.Bot) *Outbox {
+	t.Helper()
+
+	o, err := Open(path, sender.New(bot, sender.Options{GlobalRate: 1000, PerChatRate: 1000}), Options{QueueSize: 10, Workers: 2})
+	if err != nil {
+		t.Fatalf("Failed to open outbox: %v", err)
+	}
+	return o
+}
+
+func closeTestOutbox(t *testing.T, o *Outbox) {
+	t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := o.Close(ctx); err != nil {
+		t.Fatalf("Outbox didn't drain: %v", err)
+	}
+}
+
+func TestUnsentMessagesAreReplayedOnStartup(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "outbox.jsonl")
+
+	// One message per chat every 100s: the second message is stuck waiting on the limiter
+	slow := &fakeBot{}
+	o, err := Open(path, sender.New(slow, sender.Options{GlobalRate: 1000, PerChatRate: 0.01}), Options{QueueSize: 10, Workers: 2})
+	if err != nil {
+		t.Fatalf("Failed to open outbox: %v", err)
+	}
+
+	if err := o.Send(context.Background(), Message{ID: "msg-0", ChatID: 42, Text: "first"}); err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+	if err := o.Enqueue(Message{ID: "msg-1", ChatID: 42, Text: "hello"}, nil); err != nil {
+		t.Fatalf("Enqueue failed: %v", err)
+	}
+
+	// The process is stopped before the second send goes out
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := o.Close(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected interrupted close, got %v", err)
+	}
+
+	// ...and the power goes out in the middle of the next journal write
+	f, _ := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0o600)
+	f.WriteString(`{"op":"enqueue","messa`)
+	f.Close()
+
+	bot := &fakeBot{}
+	o = openTestOutbox(t, path, bot)
+	closeTestOutbox(t, o)
+
+	if got := bot.sent(); len(got) != 1 || got[0] != "hello" {
+		t.Errorf("Expected only the unsent message to be replayed, got %v", got)
+	}
+}
+
+func TestCloseReportsInterruptedSends(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "outbox.jsonl")
+	o, err := Open(path, sender.New(&fakeBot{}, sender.Options{GlobalRate: 1000, PerChatRate: 0.01}), Options{QueueSize: 10, Workers: 1})
+	if err != nil {
+		t.Fatalf("Failed to open outbox: %v", err)
+	}
+
+	o.Send(context.Background(), Message{ChatID: 42, Text: "first"})
+
+	result := make(chan error, 1)
+	o.Enqueue(Message{ChatID: 42, Text: "second"}, func(err error) { result <- err })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	o.Close(ctx)
+
+	if err := <-result; !errors.Is(err, ErrInterrupted) {
+		t.Errorf("Expected ErrInterrupted, got %v", err)
+	}
+	if err := o.Enqueue(Message{ChatID: 42, Text: "third"}, nil); !errors.Is(err, ErrClosed) {
+		t.Errorf("Expected ErrClosed after Close, got %v", err)
+	}
+}
+
+func TestDeliveredMessageIsNotResent(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "outbox.jsonl")
+	bot := &fakeBot{}
+	msg := Message{ID: "job:7", ChatID: 42, Text: "reminder"}
+
+	o := openTestOutbox(t, path, bot)
+	for i := 0; i < 3; i++ {
+		if err := o.Send(context.Background(), msg); err != nil {
+			t.Fatalf("Send %d failed: %v", i, err)
+		}
+	}
+	closeTestOutbox(t, o)
+
+	// Deduplication survives a restart
+	o = openTestOutbox(t, path, bot)
+	if err := o.Send(context.Background(), msg); err != nil {
+		t.Fatalf("Send after restart failed: %v", err)
+	}
+	closeTestOutbox(t, o)
+
+	if got := len(bot.sent()); got != 1 {
+		t.Errorf("Expected exactly 1 Telegram send, got %d", got)
+	}
+}
+
+func TestFailedSendIsReportedAndDropped(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "outbox.jsonl")
+	bot := &fakeBot{err: tele.ErrBlockedByUser}
+
+	o := openTestOutbox(t, path, bot)
+	err := o.Send(context.Background(), Message{ID: "job:8", ChatID: 42, Text: "reminder"})
+	if !errors.Is(err, tele.ErrBlockedByUser) {
+		t.Errorf("Expected the Telegram error, got %v", err)
+	}
+	closeTestOutbox(t, o)
+
+	// Retrying is the caller's call, so nothing is replayed
+	o = openTestOutbox(t, path, bot)
+	closeTestOutbox(t, o)
+
+	data, _ := os.ReadFile(path)
+	if len(data) != 0 {
+		t.Errorf("Expected an empty journal after compaction, got %q", data)
+	}
+}
+
+func TestCompactionKeepsOnlyLiveRecords(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "outbox.jsonl")
+	bot := &fakeBot{}
+
+	o := openTestOutbox(t, path, bot)
+	for i := 0; i < 5; i++ {
+		o.Send(context.Background(), Message{ChatID: int64(i), Text: "hi"})
+	}
+	closeTestOutbox(t, o)
+
+	before, _ := os.ReadFile(path)
+	if got := bytes.Count(before, []byte("\n")); got != 10 {
+		t.Fatalf("Expected 5 enqueue and 5 done records, got %d lines", got)
+	}
+
+	o = openTestOutbox(t, path, bot)
+	closeTestOutbox(t, o)
+
+	after, _ := os.ReadFile(path)
+	if got := bytes.Count(after, []byte("\n")); got != 5 {
+		t.Errorf("Expected only the 5 delivered IDs after compaction, got %d lines", got)
+	}
+	if bytes.Contains(after, []byte(`"op":"enqueue"`)) {
+		t.Errorf("Expected no pending messages after compaction, got %s", after)
+	}
+}
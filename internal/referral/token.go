@@ -0,0 +1,98 @@
+package referral
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"strconv"
+	"strings"
+)
+
+const (
+	// SignedPrefix marks a signed referral start parameter
+	SignedPrefix = "rs_"
+	// LegacyPrefix marks an unsigned referral start parameter (ref_<telegramID>)
+	LegacyPrefix = "ref_"
+
+	idSize  = 8
+	macSize = 12
+)
+
+var (
+	// ErrInvalidToken is returned when a start parameter is not a well-formed referral token
+	ErrInvalidToken = errors.New("invalid referral token")
+	// ErrBadSignature is returned when the token signature doesn't match the referrer ID
+	ErrBadSignature = errors.New("referral token signature mismatch")
+	// ErrLegacyDisabled is returned for ref_ links when legacy referrals are turned off
+	ErrLegacyDisabled = errors.New("legacy referral links are disabled")
+	// ErrNoSecret is returned when signing or verifying without a configured secret
+	ErrNoSecret = errors.New("referral secret not configured")
+)
+
+// Sign returns a compact signed start parameter for the referrer.
+// The result is rs_ + base64url(id || HMAC-SHA256(id)[:12]), 30 characters,
+// which fits Telegram's 64-character deep link limit.
+func Sign(referrerID int64, secret string) (string, error) {
+	if secret == "" {
+		return "", ErrNoSecret
+	}
+
+	buf := make([]byte, idSize, idSize+macSize)
+	binary.BigEndian.PutUint64(buf, uint64(referrerID))
+	buf = append(buf, mac(buf, secret)...)
+
+	return SignedPrefix + base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// Parse extracts the referrer ID from a /start parameter.
+// Signed tokens are verified against secret; legacy ref_ links are only
+// accepted when allowLegacy is true.
+func Parse(param, secret string, allowLegacy bool) (int64, error) {
+	switch {
+	case strings.HasPrefix(param, SignedPrefix):
+		return verify(strings.TrimPrefix(param, SignedPrefix), secret)
+	case strings.HasPrefix(param, LegacyPrefix):
+		if !allowLegacy {
+			return 0, ErrLegacyDisabled
+		}
+		referrerID, err := strconv.ParseInt(strings.TrimPrefix(param, LegacyPrefix), 10, 64)
+		if err != nil || referrerID <= 0 {
+			return 0, ErrInvalidToken
+		}
+		return referrerID, nil
+	default:
+		return 0, ErrInvalidToken
+	}
+}
+
+// verify checks the signature of an encoded token and returns the referrer ID
+func verify(encoded, secret string) (int64, error) {
+	if secret == "" {
+		return 0, ErrNoSecret
+	}
+
+	raw, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil || len(raw) != idSize+macSize {
+		return 0, ErrInvalidToken
+	}
+
+	id, sig := raw[:idSize], raw[idSize:]
+	if !hmac.Equal(sig, mac(id, secret)) {
+		return 0, ErrBadSignature
+	}
+
+	referrerID := int64(binary.BigEndian.Uint64(id))
+	if referrerID <= 0 {
+		return 0, ErrInvalidToken
+	}
+	return referrerID, nil
+}
+
+// mac returns the truncated HMAC-SHA256 of data
+func mac(data []byte, secret string) []byte {
+	h := hmac.New(sha256.New, []byte(secret))
+	h.Write(data)
+	return h.Sum(nil)[:macSize]
+}
@@ -0,0 +1,67 @@
+package referral
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestSignAndParse(t *testing.T) {
+	token, err := Sign(41361615, "test-secret")
+	if err != nil {
+		t.Fatalf("Sign returned error: %v", err)
+	}
+
+	if len(token) > 64 {
+		t.Errorf("Expected token to fit 64 chars, got %d", len(token))
+	}
+
+	id, err := Parse(token, "test-secret", false)
+	if err != nil {
+		t.Errorf("Parse returned error: %v", err)
+	}
+	if id != 41361615 {
+		t.Errorf("Expected referrer 41361615, got %d", id)
+	}
+}
+
+func TestParseRejectsForgedTokens(t *testing.T) {
+	token, _ := Sign(111, "test-secret")
+	other, _ := Sign(222, "other-secret")
+
+	tests := []struct {
+		name  string
+		param string
+		want  error
+	}{
+		{"wrong secret", other, ErrBadSignature},
+		{"tampered", token[:len(token)-2] + "AA", ErrBadSignature},
+		{"truncated", token[:10], ErrInvalidToken},
+		{"garbage", "rs_!!!", ErrInvalidToken},
+		{"unknown prefix", "foo_123", ErrInvalidToken},
+		{"legacy disabled", "ref_111", ErrLegacyDisabled},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Parse(tt.param, "test-secret", false); !errors.Is(err, tt.want) {
+				t.Errorf("Expected %v, got %v", tt.want, err)
+			}
+		})
+	}
+}
+
+func TestParseLegacy(t *testing.T) {
+	id, err := Parse("ref_123456789", "test-secret", true)
+	if err != nil {
+		t.Errorf("Parse returned error: %v", err)
+	}
+	if id != 123456789 {
+		t.Errorf("Expected referrer 123456789, got %d", id)
+	}
+
+	for _, param := range []string{"ref_abc", "ref_123abc", "ref_123 ", "ref_-5", "ref_"} {
+		if _, err := Parse(param, "test-secret", true); !errors.Is(err, ErrInvalidToken) {
+			t.Errorf("Expected ErrInvalidToken for %q, got %v", param, err)
+		}
+	}
+}
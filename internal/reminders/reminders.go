@@ -0,0 +1,387 @@
+// Package reminders loads the daily reminder texts from text/template files.
+//
+// Templates live in templates/<lang>/<kind>/<id>.tmpl and are embedded in the binary.
+// An override directory with the same layout can replace them without a rebuild: a
+// language and kind present there replaces the whole built-in set for that pair, and
+// everything else keeps the built-in texts. Languages or kinds without templates fall
+// back to English.
+//
+// Every template is validated when loaded, so a typo in a field name or a text over
+// Telegram's length limit is rejected before any user could receive it. A Store keeps
+// serving the last valid set when a reload fails.
+package reminders
+
+import (
+	"context"
+	"embed"
+	"fmt"
+	"hash/fnv"
+	"io/fs"
+	"log"
+	"math/rand"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"text/template"
+	"time"
+	"unicode/utf8"
+
+	"decodeBot/internal/experiments"
+	"decodeBot/internal/i18n"
+)
+
+// MaxMessageLength is the longest text Telegram accepts in one message
+const MaxMessageLength = 4096
+
+// Kind selects which reminder a user gets
+type Kind string
+
+// Reminder kinds, named after their directories
+const (
+	KindStreak   Kind = "streak"    // the user has an active streak
+	KindNoStreak Kind = "no_streak" // the user has no streak to keep
+)
+
+var kinds = []Kind{KindStreak, KindNoStreak}
+
+//go:embed templates
+var embedded embed.FS
+
+// Data is what a template can reference: {{.Name}}, {{.Streak}} and {{.Days}}.
+// Fields are inserted verbatim, so the caller escapes them for the parse mode.
+type Data struct {
+	Name   string // the user's first name
+	Streak int    // streak length, 0 for KindNoStreak
+	Days   string // the streak as a localized phrase, e.g. "5 days"
+}
+
+// sample is rendered during validation. The name is as long as Telegram allows.
+var sample = Data{
+	Name:   strings.Repeat("W", 64),
+	Streak: 99999,
+	Days:   strings.Repeat("D", 32),
+}
+
+// Variant is one reminder text
+type Variant struct {
+	ID   string // file name without the extension, stable across reloads
+	tmpl *template.Template
+}
+
+// Render fills in the template
+func (v Variant) Render(data Data) (string, error) {
+	var sb strings.Builder
+	if err := v.tmpl.Execute(&sb, data); err != nil {
+		return "", err
+	}
+	// Files usually end with a newline, which isn't part of the message
+	return strings.TrimSpace(sb.String()), nil
+}
+
+// Set is one loaded, validated generation of templates
+type Set struct {
+	variants map[string]map[Kind][]Variant // by language, then kind
+}
+
+// Variants returns the variants of a kind for a language, sorted by ID, falling back
+// to English when the language has none
+func (s *Set) Variants(lang string, kind Kind) []Variant {
+	if v := s.variants[lang][kind]; len(v) > 0 {
+		return v
+	}
+	return s.variants[i18n.DefaultLanguage][kind]
+}
+
+// Load parses the embedded templates and, when dir isn't empty, the overrides in it
+func Load(dir string) (*Set, error) {
+	set, err := loadFS(embedded, "templates")
+	if err != nil {
+		return nil, fmt.Errorf("built-in templates: %w", err)
+	}
+	if dir == "" {
+		return set, nil
+	}
+
+	overrides, err := loadFS(os.DirFS(dir), ".")
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", dir, err)
+	}
+	for lang, byKind := range overrides.variants {
+		if set.variants[lang] == nil {
+			set.variants[lang] = make(map[Kind][]Variant)
+		}
+		for kind, variants := range byKind {
+			set.variants[lang][kind] = variants
+		}
+	}
+	return set, nil
+}
+
+// loadFS parses <root>/<lang>/<kind>/*.tmpl. Files with other extensions are ignored,
+// so editor backups in an override directory don't break loading.
+func loadFS(fsys fs.FS, root string) (*Set, error) {
+	langs, err := fs.ReadDir(fsys, root)
+	if err != nil {
+		return nil, err
+	}
+
+	set := &Set{variants: make(map[string]map[Kind][]Variant)}
+	for _, lang := range langs {
+		if !lang.IsDir() {
+			continue
+		}
+		kindDirs, err := fs.ReadDir(fsys, path.Join(root, lang.Name()))
+		if err != nil {
+			return nil, err
+		}
+		for _, kindDir := range kindDirs {
+			if !kindDir.IsDir() {
+				continue
+			}
+			kind := Kind(kindDir.Name())
+			if !validKind(kind) {
+				return nil, fmt.Errorf("%s/%s: unknown reminder kind (use %q or %q)", lang.Name(), kind, KindStreak, KindNoStreak)
+			}
+			variants, err := loadVariants(fsys, path.Join(root, lang.Name(), string(kind)), lang.Name()+"/"+string(kind))
+			if err != nil {
+				return nil, err
+			}
+			if len(variants) == 0 {
+				continue
+			}
+			if set.variants[lang.Name()] == nil {
+				set.variants[lang.Name()] = make(map[Kind][]Variant)
+			}
+			set.variants[lang.Name()][kind] = variants
+		}
+	}
+	return set, nil
+}
+
+// loadVariants parses and validates every template in one kind directory
+func loadVariants(fsys fs.FS, dir, name string) ([]Variant, error) {
+	files, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var variants []Variant
+	for _, f := range files {
+		if f.IsDir() || path.Ext(f.Name()) != ".tmpl" {
+			continue
+		}
+		data, err := fs.ReadFile(fsys, path.Join(dir, f.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		v := Variant{ID: strings.TrimSuffix(f.Name(), ".tmpl")}
+		v.tmpl, err = template.New(name + "/" + f.Name()).Option("missingkey=error").Parse(string(data))
+		if err != nil {
+			return nil, err
+		}
+		if err := validate(v); err != nil {
+			return nil, fmt.Errorf("%s/%s: %w", name, f.Name(), err)
+		}
+		variants = append(variants, v)
+	}
+	return variants, nil
+}
+
+// validate renders a variant with sample data. Referencing a field Data doesn't have
+// fails here rather than at send time.
+func validate(v Variant) error {
+	text, err := v.Render(sample)
+	if err != nil {
+		return err
+	}
+	if text == "" {
+		return fmt.Errorf("renders an empty message")
+	}
+	// Markup counts too, which errs on the safe side: Telegram measures the parsed text
+	if n := utf8.RuneCountInString(text); n > MaxMessageLength {
+		return fmt.Errorf("renders %d characters with a %d-character name, over Telegram's limit of %d", n, utf8.RuneCountInString(sample.Name), MaxMessageLength)
+	}
+	return nil
+}
+
+// checkExperiments makes sure every experiment runs on a known kind and every arm
+// has an English template, so no variant under test silently disappears on reload
+func (s *Set) checkExperiments(exps *experiments.Set) error {
+	for _, e := range exps.All() {
+		kind := Kind(e.Kind)
+		if !validKind(kind) {
+			return fmt.Errorf("experiment %q: unknown reminder kind %q", e.Name, e.Kind)
+		}
+		for _, arm := range e.Arms {
+			if !s.has(i18n.DefaultLanguage, kind, arm.Variant) {
+				return fmt.Errorf("experiment %q: no %s/%s template %q", e.Name, i18n.DefaultLanguage, kind, arm.Variant)
+			}
+		}
+	}
+	return nil
+}
+
+// has reports whether a language has a variant of a kind
+func (s *Set) has(lang string, kind Kind, id string) bool {
+	for _, v := range s.variants[lang][kind] {
+		if v.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+func validKind(kind Kind) bool {
+	for _, k := range kinds {
+		if k == kind {
+			return true
+		}
+	}
+	return false
+}
+
+// Options customize how a Store picks variants; zero values use the defaults
+type Options struct {
+	Now  func() time.Time            // the clock deciding the current day; time.Now by default
+	Rand func(seed int64) *rand.Rand // RNG for the per-user shuffles; math/rand by default
+
+	// Experiments override the rotation for users assigned to one of their arms
+	Experiments *experiments.Set
+}
+
+// Choice is the variant picked for a user
+type Choice struct {
+	Variant
+	Experiment string // the experiment that assigned the variant; empty for the regular rotation
+}
+
+// Store serves the current template set and reloads it when the override directory changes
+type Store struct {
+	dir         string
+	current     atomic.Pointer[Set]
+	rotation    rotation
+	experiments *experiments.Set
+
+	mu          sync.Mutex // serializes reloads
+	fingerprint uint64     // of the override directory when it was last loaded
+}
+
+// Open loads the templates, failing if the built-in ones or the overrides in dir are invalid.
+// An empty dir uses only the built-in templates.
+func Open(dir string, opts Options) (*Store, error) {
+	s := &Store{dir: dir, rotation: newRotation(opts), experiments: opts.Experiments}
+	if err := s.Reload(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Variants returns the current variants of a kind for a language (see Set.Variants)
+func (s *Store) Variants(lang string, kind Kind) []Variant {
+	return s.current.Load().Variants(lang, kind)
+}
+
+// Pick returns today's variant of a kind for a user: their arm when an experiment runs
+// on the kind, otherwise the next one in the rotation (see rotation)
+func (s *Store) Pick(lang string, kind Kind, telegramID int64) Choice {
+	variants := s.Variants(lang, kind)
+	if e, arm, ok := s.experiments.Assign(string(kind), telegramID); ok {
+		for _, v := range variants {
+			if v.ID == arm.Variant {
+				return Choice{Variant: v, Experiment: e.Name}
+			}
+		}
+		// The arm isn't translated into the user's language, so leave them out of the results
+	}
+	return Choice{Variant: variants[s.rotation.index(telegramID, len(variants))]}
+}
+
+// Reload loads the templates again. On error the previous set stays in use.
+func (s *Store) Reload() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Taken before loading, so an edit made while loading is picked up by the next check
+	fingerprint, err := s.scan()
+	if err != nil {
+		return err
+	}
+	// Remembered even if loading fails, so a broken file is reported once, not on every check
+	s.fingerprint = fingerprint
+
+	set, err := Load(s.dir)
+	if err != nil {
+		return err
+	}
+	if err := set.checkExperiments(s.experiments); err != nil {
+		return err
+	}
+	s.current.Store(set)
+	return nil
+}
+
+// Watch reloads the templates whenever a file in the override directory changes,
+// checking every interval until ctx is done. It returns at once without an override directory.
+func (s *Store) Watch(ctx context.Context, interval time.Duration) {
+	if s.dir == "" {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		changed, err := s.changed()
+		if err != nil {
+			log.Printf("[TEMPLATES] Failed to scan %s: %v", s.dir, err)
+			continue
+		}
+		if !changed {
+			continue
+		}
+		if err := s.Reload(); err != nil {
+			log.Printf("[TEMPLATES] Reload failed, keeping the previous templates: %v", err)
+			continue
+		}
+		log.Printf("[TEMPLATES] Reloaded reminder templates from %s", s.dir)
+	}
+}
+
+// changed reports whether the override directory differs from the last load
+func (s *Store) changed() (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	fingerprint, err := s.scan()
+	return fingerprint != s.fingerprint, err
+}
+
+// scan hashes the name, size and modification time of every file in the override directory
+func (s *Store) scan() (uint64, error) {
+	h := fnv.New64a()
+	if s.dir == "" {
+		return h.Sum64(), nil
+	}
+
+	err := fs.WalkDir(os.DirFS(s.dir), ".", func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(h, "%s\x00%d\x00%d\x00", p, info.Size(), info.ModTime().UnixNano())
+		return nil
+	})
+	return h.Sum64(), err
+}
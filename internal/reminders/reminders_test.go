@@ -0,0 +1,236 @@
+package reminders
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"decodeBot/internal/experiments"
+)
+
+// writeTemplate creates <dir>/<name> with the given text
+func writeTemplate(t *testing.T, dir, name, text string) {
+	t.Helper()
+
+	p := filepath.Join(dir, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(p, []byte(text), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func ids(variants []Variant) []string {
+	var out []string
+	for _, v := range variants {
+		out = append(out, v.ID)
+	}
+	return out
+}
+
+func TestBuiltInTemplates(t *testing.T) {
+	set, err := Load("")
+	if err != nil {
+		t.Fatalf("Built-in templates are invalid: %v", err)
+	}
+
+	if got := len(set.Variants("en", KindStreak)); got != 10 {
+		t.Errorf("Expected 10 English streak reminders, got %d", got)
+	}
+	if got := len(set.Variants("en", KindNoStreak)); got != 5 {
+		t.Errorf("Expected 5 English no-streak reminders, got %d", got)
+	}
+
+	for lang, byKind := range set.variants {
+		for _, kind := range kinds {
+			if len(byKind[kind]) == 0 {
+				t.Errorf("%s: no %s reminders", lang, kind)
+			}
+			for _, v := range byKind[kind] {
+				text, _ := v.Render(sample)
+				if !strings.Contains(text, sample.Name) {
+					t.Errorf("%s/%s/%s doesn't mention the user's name", lang, kind, v.ID)
+				}
+			}
+		}
+	}
+}
+
+func TestUnknownLanguageFallsBackToEnglish(t *testing.T) {
+	set, err := Load("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := ids(set.Variants("de", KindStreak)), ids(set.Variants("en", KindStreak)); strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("Expected the English reminders %v, got %v", want, got)
+	}
+}
+
+func TestOverrideReplacesOnlyItsKind(t *testing.T) {
+	dir := t.TempDir()
+	writeTemplate(t, dir, "en/streak/custom.tmpl", "{{.Name}}, day {{.Streak}} ({{.Days}})\n")
+	writeTemplate(t, dir, "en/streak/notes.txt", "not a template {{")
+
+	set, err := Load(dir)
+	if err != nil {
+		t.Fatalf("Failed to load overrides: %v", err)
+	}
+
+	streak := set.Variants("en", KindStreak)
+	if got := ids(streak); len(got) != 1 || got[0] != "custom" {
+		t.Fatalf("Expected only the override, got %v", got)
+	}
+	text, err := streak[0].Render(Data{Name: "Neo", Streak: 3, Days: "3 days"})
+	if err != nil || text != "Neo, day 3 (3 days)" {
+		t.Errorf("Expected the trimmed override text, got %q (%v)", text, err)
+	}
+
+	if got := len(set.Variants("en", KindNoStreak)); got != 5 {
+		t.Errorf("Expected the built-in no-streak reminders to stay, got %d", got)
+	}
+	if got := len(set.Variants("ru", KindStreak)); got != 5 {
+		t.Errorf("Expected the built-in Russian reminders to stay, got %d", got)
+	}
+}
+
+func TestInvalidTemplatesAreRejected(t *testing.T) {
+	tests := []struct {
+		name string
+		file string
+		text string
+		want string
+	}{
+		{"unknown field", "en/streak/typo.tmpl", "Hi {{.FirstName}}", "can't evaluate field FirstName"},
+		{"syntax", "en/streak/broken.tmpl", "Hi {{.Name}", "broken.tmpl:1"},
+		{"too long", "en/streak/long.tmpl", "{{.Name}} " + strings.Repeat("x", MaxMessageLength), "over Telegram's limit"},
+		{"empty", "en/no_streak/blank.tmpl", "  \n", "empty message"},
+		{"unknown kind", "en/streaks/typo.tmpl", "{{.Name}}", "unknown reminder kind"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeTemplate(t, dir, tt.file, tt.text)
+
+			_, err := Load(dir)
+			if err == nil {
+				t.Fatal("Expected an error, got none")
+			}
+			if !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Expected an error mentioning %q, got %v", tt.want, err)
+			}
+		})
+	}
+}
+
+func TestReloadKeepsPreviousTemplatesOnError(t *testing.T) {
+	dir := t.TempDir()
+	writeTemplate(t, dir, "en/streak/first.tmpl", "first {{.Name}}")
+
+	store, err := Open(dir, Options{})
+	if err != nil {
+		t.Fatalf("Failed to open: %v", err)
+	}
+
+	writeTemplate(t, dir, "en/streak/first.tmpl", "second {{.Name}}")
+	if changed, err := store.changed(); err != nil || !changed {
+		t.Errorf("Expected the edit to be noticed, got changed=%v err=%v", changed, err)
+	}
+	if err := store.Reload(); err != nil {
+		t.Fatalf("Failed to reload: %v", err)
+	}
+	if text, _ := store.Variants("en", KindStreak)[0].Render(Data{Name: "Neo"}); text != "second Neo" {
+		t.Errorf("Expected the edited template, got %q", text)
+	}
+	if changed, _ := store.changed(); changed {
+		t.Error("Expected no change right after a reload")
+	}
+
+	writeTemplate(t, dir, "en/streak/first.tmpl", "third {{.Nmae}}")
+	if err := store.Reload(); err == nil {
+		t.Fatal("Expected the broken template to be rejected")
+	}
+	if text, _ := store.Variants("en", KindStreak)[0].Render(Data{Name: "Neo"}); text != "second Neo" {
+		t.Errorf("Expected the last valid template to stay in use, got %q", text)
+	}
+}
+
+// loadExperiments writes an experiments file and loads it
+func loadExperiments(t *testing.T, json string) *experiments.Set {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "experiments.json")
+	if err := os.WriteFile(path, []byte(json), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	exps, err := experiments.Load(path)
+	if err != nil {
+		t.Fatalf("Failed to load experiments: %v", err)
+	}
+	return exps
+}
+
+func TestExperimentOverridesRotation(t *testing.T) {
+	exps := loadExperiments(t, `{"experiments": [{"name": "copy", "kind": "streak", "arms": [
+		{"variant": "neural_report", "weight": 1},
+		{"variant": "surveillance", "weight": 1}
+	]}]}`)
+	clock := &fakeClock{t: time.Date(2026, 3, 14, 9, 0, 0, 0, time.UTC)}
+	store, err := Open("", Options{Now: clock.Now, Experiments: exps})
+	if err != nil {
+		t.Fatalf("Failed to open: %v", err)
+	}
+
+	for id := int64(1); id <= 50; id++ {
+		_, arm, _ := exps.Assign(string(KindStreak), id)
+		for d := 0; d < 3; d++ {
+			clock.t = clock.t.Add(24 * time.Hour)
+			if got := store.Pick("en", KindStreak, id); got.ID != arm.Variant || got.Experiment != "copy" {
+				t.Fatalf("User %d: expected %s from the experiment, got %s (experiment %q)", id, arm.Variant, got.ID, got.Experiment)
+			}
+		}
+
+		// Russian has no neural_report, so those users fall back to the rotation
+		got := store.Pick("ru", KindStreak, id)
+		if arm.Variant == "neural_report" && got.Experiment != "" {
+			t.Errorf("User %d: expected no experiment without a translation, got %q", id, got.Experiment)
+		}
+		if arm.Variant == "surveillance" && got.ID != "surveillance" {
+			t.Errorf("User %d: expected the Russian surveillance reminder, got %s", id, got.ID)
+		}
+
+		if got := store.Pick("en", KindNoStreak, id); got.Experiment != "" {
+			t.Errorf("User %d: expected no experiment on no-streak reminders, got %q", id, got.Experiment)
+		}
+	}
+}
+
+func TestExperimentNeedsItsTemplates(t *testing.T) {
+	exps := loadExperiments(t, `{"experiments": [{"name": "copy", "kind": "streak", "arms": [
+		{"variant": "custom", "weight": 1}
+	]}]}`)
+	if _, err := Open("", Options{Experiments: exps}); err == nil || !strings.Contains(err.Error(), `"custom"`) {
+		t.Errorf("Expected the missing variant to be reported, got %v", err)
+	}
+
+	dir := t.TempDir()
+	writeTemplate(t, dir, "en/streak/custom.tmpl", "{{.Name}}")
+	store, err := Open(dir, Options{Experiments: exps})
+	if err != nil {
+		t.Fatalf("Failed to open with the variant in place: %v", err)
+	}
+
+	// Replacing the English streak reminders without the variant under test is refused
+	os.Remove(filepath.Join(dir, "en", "streak", "custom.tmpl"))
+	writeTemplate(t, dir, "en/streak/other.tmpl", "{{.Name}}")
+	if err := store.Reload(); err == nil {
+		t.Error("Expected the reload to be refused")
+	}
+	if got := store.Pick("en", KindStreak, 42); got.ID != "custom" {
+		t.Errorf("Expected the previous templates to stay, got %s", got.ID)
+	}
+}
@@ -0,0 +1,75 @@
+package reminders
+
+import (
+	"encoding/binary"
+	"hash/fnv"
+	"math/rand"
+	"time"
+)
+
+// rotation picks a variant per user and day so that a user who gets a reminder every
+// day sees each variant once before any of them repeats. Days are grouped into cycles
+// as long as the variant list; each cycle walks a permutation shuffled from the user's
+// Telegram ID and the cycle number, so it needs no stored state and every replica
+// agrees on the pick.
+type rotation struct {
+	now     func() time.Time
+	newRand func(seed int64) *rand.Rand
+}
+
+func newRotation(opts Options) rotation {
+	r := rotation{now: opts.Now, newRand: opts.Rand}
+	if r.now == nil {
+		r.now = time.Now
+	}
+	if r.newRand == nil {
+		r.newRand = func(seed int64) *rand.Rand { return rand.New(rand.NewSource(seed)) }
+	}
+	return r
+}
+
+// index returns which of n variants the user gets today
+func (r rotation) index(telegramID int64, n int) int {
+	if n <= 2 {
+		// Shuffling can't do better than alternating
+		return int((day(r.now()) + seed(telegramID, 0)%2) % int64(n))
+	}
+
+	d := day(r.now())
+	cycle, pos := d/int64(n), int(d%int64(n))
+	order := r.cycle(telegramID, cycle, n)
+
+	// The first variant of a cycle mustn't repeat the last one of the previous cycle.
+	// Swapping the first two keeps the last one in place, so the check doesn't recurse.
+	if previous := r.cycle(telegramID, cycle-1, n); order[0] == previous[n-1] {
+		order[0], order[1] = order[1], order[0]
+	}
+	return order[pos]
+}
+
+// cycle returns the user's order of n variants for one cycle
+func (r rotation) cycle(telegramID, cycle int64, n int) []int {
+	order := make([]int, n)
+	for i := range order {
+		order[i] = i
+	}
+	rng := r.newRand(seed(telegramID, cycle))
+	rng.Shuffle(n, func(i, j int) { order[i], order[j] = order[j], order[i] })
+	return order
+}
+
+// day numbers UTC calendar days, so every replica sees the same day
+func day(t time.Time) int64 {
+	return t.Unix() / 86400
+}
+
+// seed mixes a user and a cycle into a non-negative RNG seed
+func seed(telegramID, cycle int64) int64 {
+	var buf [16]byte
+	binary.BigEndian.PutUint64(buf[:8], uint64(telegramID))
+	binary.BigEndian.PutUint64(buf[8:], uint64(cycle))
+
+	h := fnv.New64a()
+	h.Write(buf[:])
+	return int64(h.Sum64() >> 1)
+}
@@ -0,0 +1,131 @@
+package reminders
+
+import (
+	"math/rand"
+	"testing"
+	"time"
+)
+
+// fakeClock is a settable clock for rotation tests
+type fakeClock struct {
+	t time.Time
+}
+
+func (c *fakeClock) Now() time.Time { return c.t }
+
+// picks returns the variant index a user gets on each of the next days
+func picks(r rotation, clock *fakeClock, telegramID int64, n, days int) []int {
+	start := clock.t
+	defer func() { clock.t = start }()
+
+	out := make([]int, days)
+	for i := range out {
+		out[i] = r.index(telegramID, n)
+		clock.t = clock.t.Add(24 * time.Hour)
+	}
+	return out
+}
+
+func TestRotationShowsEveryVariantBeforeRepeating(t *testing.T) {
+	clock := &fakeClock{t: time.Date(2026, 3, 14, 9, 0, 0, 0, time.UTC)}
+	r := newRotation(Options{Now: clock.Now})
+
+	for _, n := range []int{3, 5, 10} {
+		for _, telegramID := range []int64{1, 42, 987654321} {
+			// Start on a cycle boundary so every window of n days is one cycle
+			clock.t = time.Unix(day(clock.t)/int64(n)*int64(n)*86400, 0).UTC()
+			got := picks(r, clock, telegramID, n, 6*n)
+
+			for start := 0; start < len(got); start += n {
+				seen := make(map[int]bool)
+				for _, idx := range got[start : start+n] {
+					if seen[idx] {
+						t.Errorf("n=%d user=%d: variant %d repeated within a cycle: %v", n, telegramID, idx, got)
+					}
+					seen[idx] = true
+				}
+			}
+			for i := 1; i < len(got); i++ {
+				if got[i] == got[i-1] {
+					t.Errorf("n=%d user=%d: variant %d on consecutive days: %v", n, telegramID, got[i], got)
+				}
+			}
+		}
+	}
+}
+
+func TestRotationIsDeterministic(t *testing.T) {
+	clock := &fakeClock{t: time.Date(2026, 3, 14, 9, 0, 0, 0, time.UTC)}
+	a := newRotation(Options{Now: clock.Now})
+	b := newRotation(Options{Now: clock.Now})
+
+	morning := a.index(42, 10)
+	clock.t = clock.t.Add(11 * time.Hour)
+	if evening := b.index(42, 10); evening != morning {
+		t.Errorf("Expected the same variant all day, got %d and %d", morning, evening)
+	}
+
+	users := make(map[int]bool)
+	for id := int64(1); id <= 20; id++ {
+		users[a.index(id, 10)] = true
+	}
+	if len(users) < 3 {
+		t.Errorf("Expected users to get different variants on the same day, got only %d distinct", len(users))
+	}
+}
+
+func TestRotationAvoidsRepeatAcrossCycles(t *testing.T) {
+	const n = 4
+	shuffle := func(s int64) []int {
+		order := []int{0, 1, 2, 3}
+		rand.New(rand.NewSource(s)).Shuffle(n, func(i, j int) { order[i], order[j] = order[j], order[i] })
+		return order
+	}
+
+	// Find a second shuffle that starts with the variant the first one ends with
+	odd := int64(2)
+	for shuffle(odd)[0] != shuffle(1)[n-1] {
+		odd++
+	}
+
+	// Even cycles use the first shuffle and odd cycles the second, so without the fix
+	// every odd cycle would open with the variant sent the day before
+	cycleOf := make(map[int64]int64)
+	for c := int64(-1); c <= n; c++ {
+		cycleOf[seed(42, c)] = c
+	}
+	clock := &fakeClock{t: time.Unix(0, 0).UTC()}
+	r := newRotation(Options{
+		Now: clock.Now,
+		Rand: func(s int64) *rand.Rand {
+			if cycleOf[s]%2 == 0 {
+				return rand.New(rand.NewSource(1))
+			}
+			return rand.New(rand.NewSource(odd))
+		},
+	})
+
+	got := picks(r, clock, 42, n, n*n)
+	for i := 1; i < len(got); i++ {
+		if got[i] == got[i-1] {
+			t.Errorf("Variant %d on consecutive days: %v", got[i], got)
+		}
+	}
+}
+
+func TestRotationWithFewVariants(t *testing.T) {
+	clock := &fakeClock{t: time.Date(2026, 3, 14, 9, 0, 0, 0, time.UTC)}
+	r := newRotation(Options{Now: clock.Now})
+
+	for _, idx := range picks(r, clock, 42, 1, 3) {
+		if idx != 0 {
+			t.Errorf("Expected the only variant, got %d", idx)
+		}
+	}
+	got := picks(r, clock, 42, 2, 4)
+	for i := 1; i < len(got); i++ {
+		if got[i] == got[i-1] {
+			t.Errorf("Expected two variants to alternate, got %v", got)
+		}
+	}
+}
@@ -1,29 +1,97 @@
 package scheduler
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"log"
+	"math/rand"
+	"os"
+	"sync"
+	"time"
 
 	"decodeBot/internal/bot"
 	"decodeBot/internal/client"
+	"decodeBot/internal/config"
+	"decodeBot/internal/i18n"
+	"decodeBot/internal/outbox"
+	"decodeBot/internal/reminders"
+	"decodeBot/internal/sender"
+	"decodeBot/internal/timezone"
 
 	"github.com/robfig/cron/v3"
-	tele "gopkg.in/telebot.v4"
 )
 
+// Retry timing for transient send failures
+const (
+	retryBaseDelay = 2 * time.Minute
+	retryMaxDelay  = time.Hour
+)
+
+// releaseTimeout bounds handing jobs back to the server once the shutdown deadline has passed
+const releaseTimeout = time.Second
+
 type Scheduler struct {
-	cron   *cron.Cron
-	bot    *tele.Bot
-	client *client.ServerClient
+	cron      *cron.Cron
+	outbox    *outbox.Outbox
+	client    *client.ServerClient
+	templates *reminders.Store
+
+	miniAppURL string
+
+	// ctx is cancelled when Stop runs out of time, so workers stop picking up jobs
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	defaultTimezone *time.Location
+	quietHours      timezone.QuietHours
+
+	batchSize   int
+	concurrency int
+	maxAttempts int
+
+	workerID string
+	leaseTTL time.Duration
 }
 
-func NewScheduler(bot *tele.Bot, serverClient *client.ServerClient) *Scheduler {
+func NewScheduler(out *outbox.Outbox, serverClient *client.ServerClient, templates *reminders.Store, cfg *config.Config) *Scheduler {
+	ctx, cancel := context.WithCancel(context.Background())
 	return &Scheduler{
-		cron:   cron.New(),
-		bot:    bot,
-		client: serverClient,
+		// A rate-limited batch can outlast the 2 minute tick, so never overlap runs
+		cron:      cron.New(cron.WithChain(cron.SkipIfStillRunning(cron.DefaultLogger))),
+		outbox:    out,
+		client:    serverClient,
+		templates: templates,
+
+		miniAppURL: cfg.MiniAppURL,
+
+		ctx:    ctx,
+		cancel: cancel,
+
+		defaultTimezone: cfg.DefaultTimezone,
+		quietHours: timezone.QuietHours{
+			Start: cfg.QuietHoursStart,
+			End:   cfg.QuietHoursEnd,
+		},
+
+		batchSize:   cfg.NotifyBatchSize,
+		concurrency: cfg.NotifyConcurrency,
+		maxAttempts: cfg.NotifyMaxAttempts,
+
+		workerID: workerID(),
+		leaseTTL: cfg.NotifyLeaseTTL,
 	}
 }
 
+// workerID identifies this replica when claiming jobs
+func workerID() string {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "unknown"
+	}
+	return fmt.Sprintf("%s-%d", hostname, os.Getpid())
+}
+
 // Start begins the scheduler
 func (s *Scheduler) Start() {
 	// Processing Queue every 2 minutes
@@ -40,14 +108,31 @@ func (s *Scheduler) Start() {
 	log.Println("✓ Scheduler started - Smart Notification Queue enabled")
 }
 
-// Stop stops the scheduler
-func (s *Scheduler) Stop() {
-	s.cron.Stop()
+// Stop stops scheduling new runs and waits for the running batch to finish.
+// If ctx expires first, jobs not yet handed to the outbox are released,
+// waiting at most releaseTimeout for the server to take them back.
+func (s *Scheduler) Stop(ctx context.Context) error {
+	done := s.cron.Stop()
+
+	select {
+	case <-done.Done():
+		return nil
+	case <-ctx.Done():
+	}
+
+	s.cancel()
+	select {
+	case <-done.Done():
+	case <-time.After(releaseTimeout):
+		log.Println("[SCHEDULER] Gave up releasing jobs; their leases will expire on the server")
+	}
+	return ctx.Err()
 }
 
-// ProcessNotifications fetches and sends pending notifications
+// ProcessNotifications claims pending notifications and sends them through a worker pool.
+// Only jobs leased to this replica are sent, so running several replicas is safe.
 func (s *Scheduler) ProcessNotifications() {
-	jobs, err := s.client.GetPendingNotifications(20) // Batch size 20
+	jobs, err := s.client.ClaimNotifications(s.workerID, s.batchSize, s.leaseTTL)
 	if err != nil {
 		log.Printf("[SCHEDULER] Failed to get jobs: %v", err)
 		return
@@ -57,40 +142,184 @@ func (s *Scheduler) ProcessNotifications() {
 		return
 	}
 
-	log.Printf("[SCHEDULER] Processing %d notification jobs...", len(jobs))
+	log.Printf("[SCHEDULER] Processing %d notification jobs with %d workers...", len(jobs), s.concurrency)
+
+	now := time.Now()
+	queue := make(chan client.NotificationJob)
+	var wg sync.WaitGroup
+
+	for i := 0; i < s.concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range queue {
+				s.processJob(now, job)
+			}
+		}()
+	}
 
 	for _, job := range jobs {
-		if job.User == nil {
-			log.Printf("[SCHEDULER] Job %d has no user data, skipping", job.ID)
-			s.client.UpdateJobStatus(job.ID, "FAILED")
-			continue
+		queue <- job
+	}
+	close(queue)
+	wg.Wait()
+}
+
+// processJob sends a single notification and reports the outcome to the server
+func (s *Scheduler) processJob(now time.Time, job client.NotificationJob) {
+	// Shutting down - hand the job back instead of sending it
+	if s.ctx.Err() != nil {
+		s.release(job)
+		return
+	}
+
+	if job.User == nil {
+		log.Printf("[SCHEDULER] Job %d has no user data, skipping", job.ID)
+		s.ack(job, client.JobStatusFailed)
+		return
+	}
+
+	// Rate limiting can hold a job past its lease; another replica may own it by now
+	if !job.LeaseExpiresAt.IsZero() && time.Now().After(job.LeaseExpiresAt) {
+		log.Printf("[SCHEDULER] Lease on job %d expired before sending, skipping", job.ID)
+		return
+	}
+
+	// Don't wake people up - push the job to the end of their local quiet hours
+	local := now.In(timezone.Load(job.User.Timezone, s.defaultTimezone))
+	if s.quietHours.Contains(local) {
+		until := s.quietHours.NextEnd(local)
+		log.Printf("[SCHEDULER] Job %d deferred to %s (quiet hours for %d)", job.ID, until.Format(time.RFC3339), job.User.TelegramID)
+		if err := s.client.DeferJob(job, until); err != nil {
+			log.Printf("[SCHEDULER] Failed to defer job %d: %v", job.ID, err)
 		}
+		return
+	}
 
-		var message string
-		if job.Type == "DAILY_CHALLENGE" {
-			// Calculate best streak
-			streak := 0
-			if job.User.AllStreak > streak {
-				streak = job.User.AllStreak
-			}
-			message = bot.GetDailyReminderMessage(job.User.FirstName, streak)
-		} else {
-			// Default fallback
-			message = bot.GetDailyReminderMessage(job.User.FirstName, 0)
+	loc := i18n.Resolve(job.User.LanguageCode)
+
+	var message string
+	var choice reminders.Choice
+	if job.Type == "DAILY_CHALLENGE" {
+		// Calculate best streak
+		streak := 0
+		if job.User.AllStreak > streak {
+			streak = job.User.AllStreak
 		}
+		message, choice = bot.GetDailyReminderMessage(s.templates, loc, job.User.TelegramID, job.User.FirstName, streak)
+	} else {
+		// Default fallback
+		message, choice = bot.GetDailyReminderMessage(s.templates, loc, job.User.TelegramID, job.User.FirstName, 0)
+	}
 
-		menu := bot.GetMainMenu()
-		recipient := &tele.User{ID: job.User.TelegramID}
+	err := s.outbox.Send(s.ctx, outbox.Message{
+		// A job re-claimed after a crash isn't sent twice if the outbox already delivered it
+		ID:        fmt.Sprintf("job:%d", job.ID),
+		ChatID:    job.User.TelegramID,
+		Text:      message,
+		ParseMode: bot.ParseMode,
+		Markup:    bot.GetMainMenu(loc, s.miniAppURL),
+		// Don't send once the lease lapses; another replica may own the job by then
+		ExpiresAt: job.LeaseExpiresAt,
+	})
+	switch {
+	case errors.Is(err, outbox.ErrFull), errors.Is(err, outbox.ErrClosed):
+		// Never made it into the outbox - hand it to someone else
+		s.release(job)
+		return
+	case errors.Is(err, outbox.ErrExpired):
+		log.Printf("[SCHEDULER] Lease on job %d expired while waiting to send, skipping", job.ID)
+		return
+	case errors.Is(err, outbox.ErrInterrupted), err != nil && s.ctx.Err() != nil:
+		// Journaled but not sent yet; releasing could send it twice, so let the lease lapse
+		log.Printf("[SCHEDULER] Job %d left in the outbox at shutdown", job.ID)
+		return
+	}
 
-		if _, err := s.bot.Send(recipient, message, menu); err != nil {
-			log.Printf("[SCHEDULER] Failed to send to %d: %v", job.User.TelegramID, err)
+	kind := sender.Classify(err)
+	if kind == sender.KindNone {
+		log.Printf("[NOTIF] Sent %s to %s (@%s)", choice.ID, job.User.FirstName, job.User.Username)
+		// The variant lets the server tell which copy brought the user back
+		if err := s.client.AckSentJob(job, client.JobVariant{ID: choice.ID, Experiment: choice.Experiment}); err != nil {
+			log.Printf("[SCHEDULER] Failed to ack job %d as %s: %v", job.ID, client.JobStatusSent, err)
+		}
+		return
+	}
 
-			// If blocked, maybe mark as FAILED or BLOCKED?
-			// For now, marked as FAILED so we don't retry immediately (logic in server GetPending checks status=PENDING)
-			s.client.UpdateJobStatus(job.ID, "FAILED")
-		} else {
-			log.Printf("[NOTIF] Sent to %s (@%s)", job.User.FirstName, job.User.Username)
-			s.client.UpdateJobStatus(job.ID, "SENT")
+	// Telegram hiccups shouldn't make a reminder disappear - try again later
+	if kind.Transient() {
+		s.retryJob(job, kind, err)
+		return
+	}
+
+	status := jobStatusFor(kind)
+	log.Printf("[SCHEDULER] Failed to send to %d (%s): %v", job.User.TelegramID, status, err)
+	s.ack(job, status)
+
+	// Stop the server from scheduling users we can't reach anymore
+	if kind.Unreachable() {
+		if err := s.client.MarkUserUnreachable(job.User.TelegramID, status); err != nil {
+			log.Printf("[SCHEDULER] Failed to mark user %d unreachable: %v", job.User.TelegramID, err)
 		}
 	}
 }
+
+// ack reports the job outcome, logging instead of failing since the send already happened
+func (s *Scheduler) ack(job client.NotificationJob, status string) {
+	if err := s.client.AckJob(job, status); err != nil {
+		log.Printf("[SCHEDULER] Failed to ack job %d as %s: %v", job.ID, status, err)
+	}
+}
+
+// release returns an unsent job to the queue right away so another replica can pick it up
+func (s *Scheduler) release(job client.NotificationJob) {
+	ctx, cancel := context.WithTimeout(context.Background(), releaseTimeout)
+	defer cancel()
+
+	if err := s.client.ReleaseJob(ctx, job); err != nil {
+		log.Printf("[SCHEDULER] Failed to release job %d: %v", job.ID, err)
+	}
+}
+
+// retryJob schedules another delivery attempt, or dead-letters the job once attempts run out
+func (s *Scheduler) retryJob(job client.NotificationJob, kind sender.Kind, sendErr error) {
+	attempts := job.Attempts + 1
+	if attempts >= s.maxAttempts {
+		log.Printf("[SCHEDULER] Job %d dead-lettered after %d attempts (%s): %v", job.ID, attempts, kind, sendErr)
+		s.ack(job, client.JobStatusDeadLetter)
+		return
+	}
+
+	next := time.Now().Add(retryBackoff(attempts))
+	log.Printf("[SCHEDULER] Job %d attempt %d/%d failed (%s), retrying at %s: %v",
+		job.ID, attempts, s.maxAttempts, kind, next.Format(time.RFC3339), sendErr)
+	if err := s.client.RetryJob(job, attempts, next); err != nil {
+		log.Printf("[SCHEDULER] Failed to schedule retry for job %d: %v", job.ID, err)
+	}
+}
+
+// retryBackoff returns an exponential delay with full jitter for the given attempt (1-based)
+func retryBackoff(attempt int) time.Duration {
+	delay := retryBaseDelay << uint(attempt-1)
+	if delay <= 0 || delay > retryMaxDelay {
+		delay = retryMaxDelay
+	}
+
+	// Full jitter spreads retries out so a Telegram outage doesn't cause a thundering herd
+	return retryBaseDelay/2 + time.Duration(rand.Int63n(int64(delay)))
+}
+
+// jobStatusFor maps a permanent send failure to the job status reported to the server.
+// Transient failures never get here; they are retried via retryJob.
+func jobStatusFor(kind sender.Kind) string {
+	switch kind {
+	case sender.KindBlocked:
+		return client.JobStatusBlocked
+	case sender.KindDeactivated:
+		return client.JobStatusDeactivated
+	case sender.KindChatNotFound:
+		return client.JobStatusChatNotFound
+	default:
+		return client.JobStatusFailed
+	}
+}
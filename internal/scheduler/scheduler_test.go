@@ -0,0 +1,493 @@
+package scheduler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"decodeBot/internal/client"
+	"decodeBot/internal/config"
+	"decodeBot/internal/experiments"
+	"decodeBot/internal/models"
+	"decodeBot/internal/outbox"
+	"decodeBot/internal/reminders"
+	"decodeBot/internal/sender"
+	"decodeBot/internal/timezone"
+
+	tele "gopkg.in/telebot.v4"
+)
+
+// jobUpdate is the body of a job status update
+type jobUpdate struct {
+	Status        string `json:"status"`
+	LeaseToken    string `json:"lease_token"`
+	Attempts      int    `json:"attempts"`
+	NextAttemptAt string `json:"next_attempt_at"`
+	ScheduledAt   string `json:"scheduled_at"`
+	VariantID     string `json:"variant_id"`
+	Experiment    string `json:"experiment"`
+}
+
+// fakeBackend implements the claim/ack protocol of the notification queue
+type fakeBackend struct {
+	mu      sync.Mutex
+	jobs    map[uint]*client.NotificationJob
+	updates map[uint]jobUpdate // last accepted update per job
+	leases  int
+}
+
+func newFakeBackend(n int) *fakeBackend {
+	b := &fakeBackend{
+		jobs:    make(map[uint]*client.NotificationJob),
+		updates: make(map[uint]jobUpdate),
+	}
+	for i := 1; i <= n; i++ {
+		b.jobs[uint(i)] = &client.NotificationJob{
+			ID:     uint(i),
+			Type:   "DAILY_CHALLENGE",
+			Status: client.JobStatusPending,
+			User:   &models.User{TelegramID: int64(1000 + i), FirstName: "Agent"},
+		}
+	}
+	return b
+}
+
+func (b *fakeBackend) handler() http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("POST /api/bot/notifications/claim", func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Limit        int `json:"limit"`
+			LeaseSeconds int `json:"lease_seconds"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+
+		b.mu.Lock()
+		defer b.mu.Unlock()
+
+		now := time.Now()
+		claimed := []client.NotificationJob{}
+		for _, job := range b.jobs {
+			if len(claimed) == req.Limit {
+				break
+			}
+			if job.Status != client.JobStatusPending || now.Before(job.LeaseExpiresAt) {
+				continue
+			}
+			b.leases++
+			job.LeaseToken = strconv.Itoa(b.leases)
+			job.LeaseExpiresAt = now.Add(time.Duration(req.LeaseSeconds) * time.Second)
+			claimed = append(claimed, *job)
+		}
+
+		json.NewEncoder(w).Encode(map[string]interface{}{"jobs": claimed})
+	})
+
+	mux.HandleFunc("POST /api/bot/notifications/{id}", func(w http.ResponseWriter, r *http.Request) {
+		var req jobUpdate
+		json.NewDecoder(r.Body).Decode(&req)
+		id, _ := strconv.Atoi(r.PathValue("id"))
+
+		b.mu.Lock()
+		defer b.mu.Unlock()
+
+		job, ok := b.jobs[uint(id)]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		if job.LeaseToken != req.LeaseToken {
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+		job.Status = req.Status
+		job.LeaseToken = ""
+		b.updates[job.ID] = req
+		w.WriteHeader(http.StatusOK)
+	})
+
+	return mux
+}
+
+// recordingBot counts messages delivered per chat
+type recordingBot struct {
+	mu    sync.Mutex
+	sends map[string]int
+}
+
+func (r *recordingBot) Send(to tele.Recipient, what interface{}, opts ...interface{}) (*tele.Message, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.sends[to.Recipient()]++
+	return &tele.Message{}, nil
+}
+
+// add stores a job and leases it, as if this replica had just claimed it
+func (b *fakeBackend) add(job client.NotificationJob) client.NotificationJob {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.leases++
+	job.LeaseToken = strconv.Itoa(b.leases)
+	job.LeaseExpiresAt = time.Now().Add(time.Minute)
+	b.jobs[job.ID] = &job
+	return job
+}
+
+// update returns the last update accepted for a job
+func (b *fakeBackend) update(id uint) (jobUpdate, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	u, ok := b.updates[id]
+	return u, ok
+}
+
+// failingBot fails every send with err
+type failingBot struct {
+	err error
+}
+
+func (f *failingBot) Send(to tele.Recipient, what interface{}, opts ...interface{}) (*tele.Message, error) {
+	return nil, f.err
+}
+
+func newTestScheduler(t *testing.T, url string, bot sender.Bot) *Scheduler {
+	cfg := &config.Config{
+		DefaultTimezone:   time.UTC,
+		NotifyBatchSize:   5,
+		NotifyConcurrency: 3,
+		SendRateGlobal:    1000,
+		SendRatePerChat:   1000,
+		NotifyMaxAttempts: 5,
+		NotifyLeaseTTL:    time.Minute,
+	}
+	return NewScheduler(newTestOutbox(t, bot, cfg), client.NewServerClient(url, "test-secret"), newTestTemplates(t), cfg)
+}
+
+// newTestTemplates loads the built-in reminder templates
+func newTestTemplates(t *testing.T) *reminders.Store {
+	t.Helper()
+
+	templates, err := reminders.Open("", reminders.Options{})
+	if err != nil {
+		t.Fatalf("Failed to load reminder templates: %v", err)
+	}
+	return templates
+}
+
+// newTestOutbox opens an outbox in a temporary directory, closed when the test ends
+func newTestOutbox(t *testing.T, bot sender.Bot, cfg *config.Config) *outbox.Outbox {
+	t.Helper()
+
+	msgSender := sender.New(bot, sender.Options{GlobalRate: cfg.SendRateGlobal, PerChatRate: cfg.SendRatePerChat})
+	out, err := outbox.Open(filepath.Join(t.TempDir(), "outbox.jsonl"), msgSender, outbox.Options{})
+	if err != nil {
+		t.Fatalf("Failed to open outbox: %v", err)
+	}
+	t.Cleanup(func() {
+		out.Close(context.Background())
+	})
+	return out
+}
+
+func TestTwoSchedulersNeverDeliverTheSameJobTwice(t *testing.T) {
+	const jobCount = 40
+
+	backend := newFakeBackend(jobCount)
+	server := httptest.NewServer(backend.handler())
+	defer server.Close()
+
+	bot := &recordingBot{sends: make(map[string]int)}
+	replicas := []*Scheduler{
+		newTestScheduler(t, server.URL, bot),
+		newTestScheduler(t, server.URL, bot),
+	}
+
+	// Both replicas tick at the same moment, repeatedly, until the queue drains
+	for round := 0; round < jobCount; round++ {
+		var wg sync.WaitGroup
+		for _, s := range replicas {
+			wg.Add(1)
+			go func(s *Scheduler) {
+				defer wg.Done()
+				s.ProcessNotifications()
+			}(s)
+		}
+		wg.Wait()
+	}
+
+	for i := 1; i <= jobCount; i++ {
+		chat := fmt.Sprint(1000 + i)
+		if got := bot.sends[chat]; got != 1 {
+			t.Errorf("Expected exactly 1 message to %s, got %d", chat, got)
+		}
+		if status := backend.jobs[uint(i)].Status; status != client.JobStatusSent {
+			t.Errorf("Expected job %d to be SENT, got %s", i, status)
+		}
+	}
+}
+
+func TestExpiredLeaseIsNotSent(t *testing.T) {
+	backend := newFakeBackend(0)
+	server := httptest.NewServer(backend.handler())
+	defer server.Close()
+
+	bot := &recordingBot{sends: make(map[string]int)}
+	s := newTestScheduler(t, server.URL, bot)
+
+	job := client.NotificationJob{
+		ID:             1,
+		Type:           "DAILY_CHALLENGE",
+		User:           &models.User{TelegramID: 1001, FirstName: "Agent"},
+		LeaseToken:     "stale",
+		LeaseExpiresAt: time.Now().Add(-time.Second),
+	}
+	s.processJob(time.Now(), job)
+
+	if len(bot.sends) != 0 {
+		t.Errorf("Expected no sends for an expired lease, got %v", bot.sends)
+	}
+}
+
+func TestQuietHoursDeferJob(t *testing.T) {
+	backend := newFakeBackend(0)
+	server := httptest.NewServer(backend.handler())
+	defer server.Close()
+
+	bot := &recordingBot{sends: make(map[string]int)}
+	s := newTestScheduler(t, server.URL, bot)
+
+	// 23:30 in Tokyo, inside the default 22-8 quiet window
+	now := time.Date(2024, 3, 10, 14, 30, 0, 0, time.UTC)
+	s.quietHours = timezone.QuietHours{Start: 22, End: 8}
+
+	job := backend.add(client.NotificationJob{
+		ID:   1,
+		Type: "DAILY_CHALLENGE",
+		User: &models.User{TelegramID: 1001, FirstName: "Agent", Timezone: "Asia/Tokyo"},
+	})
+	s.processJob(now, job)
+
+	if len(bot.sends) != 0 {
+		t.Errorf("Expected no sends during quiet hours, got %v", bot.sends)
+	}
+
+	update, ok := backend.update(1)
+	if !ok {
+		t.Fatal("Expected the job to be deferred")
+	}
+	if update.Status != client.JobStatusPending {
+		t.Errorf("Expected status PENDING, got %s", update.Status)
+	}
+
+	// 08:00 Tokyo the next morning
+	if want := "2024-03-10T23:00:00Z"; update.ScheduledAt != want {
+		t.Errorf("Expected scheduled_at %s, got %s", want, update.ScheduledAt)
+	}
+}
+
+func TestTransientFailureIsRetried(t *testing.T) {
+	backend := newFakeBackend(0)
+	server := httptest.NewServer(backend.handler())
+	defer server.Close()
+
+	s := newTestScheduler(t, server.URL, &failingBot{err: tele.ErrInternal})
+
+	job := backend.add(client.NotificationJob{
+		ID:       1,
+		Type:     "DAILY_CHALLENGE",
+		Attempts: 1,
+		User:     &models.User{TelegramID: 1001, FirstName: "Agent"},
+	})
+	before := time.Now().Truncate(time.Second)
+	s.processJob(time.Now(), job)
+
+	update, ok := backend.update(1)
+	if !ok {
+		t.Fatal("Expected the job to be updated")
+	}
+	if update.Status != client.JobStatusRetry {
+		t.Errorf("Expected status RETRY, got %s", update.Status)
+	}
+	if update.Attempts != 2 {
+		t.Errorf("Expected attempts 2, got %d", update.Attempts)
+	}
+
+	next, err := time.Parse(time.RFC3339, update.NextAttemptAt)
+	if err != nil {
+		t.Fatalf("Invalid next_attempt_at %q: %v", update.NextAttemptAt, err)
+	}
+	// Second attempt: base/2 plus up to 2x base of jitter
+	if min, max := before.Add(retryBaseDelay/2), time.Now().Add(retryBaseDelay/2+2*retryBaseDelay); next.Before(min) || next.After(max) {
+		t.Errorf("Expected next attempt between %s and %s, got %s", min, max, next)
+	}
+}
+
+func TestLastAttemptIsDeadLettered(t *testing.T) {
+	backend := newFakeBackend(0)
+	server := httptest.NewServer(backend.handler())
+	defer server.Close()
+
+	s := newTestScheduler(t, server.URL, &failingBot{err: tele.ErrInternal})
+
+	job := backend.add(client.NotificationJob{
+		ID:       1,
+		Type:     "DAILY_CHALLENGE",
+		Attempts: s.maxAttempts - 1,
+		User:     &models.User{TelegramID: 1001, FirstName: "Agent"},
+	})
+	s.processJob(time.Now(), job)
+
+	if update, _ := backend.update(1); update.Status != client.JobStatusDeadLetter {
+		t.Errorf("Expected status DEAD_LETTER, got %q", update.Status)
+	}
+}
+
+func TestPermanentFailureIsNotRetried(t *testing.T) {
+	backend := newFakeBackend(0)
+	server := httptest.NewServer(backend.handler())
+	defer server.Close()
+
+	s := newTestScheduler(t, server.URL, &failingBot{err: tele.ErrBlockedByUser})
+
+	job := backend.add(client.NotificationJob{
+		ID:   1,
+		Type: "DAILY_CHALLENGE",
+		User: &models.User{TelegramID: 1001, FirstName: "Agent"},
+	})
+	s.processJob(time.Now(), job)
+
+	if update, _ := backend.update(1); update.Status != client.JobStatusBlocked {
+		t.Errorf("Expected status BLOCKED, got %q", update.Status)
+	}
+}
+
+func TestRetryBackoff(t *testing.T) {
+	for attempt := 1; attempt <= 10; attempt++ {
+		ceiling := retryBaseDelay << uint(attempt-1)
+		if ceiling > retryMaxDelay {
+			ceiling = retryMaxDelay
+		}
+
+		for i := 0; i < 100; i++ {
+			d := retryBackoff(attempt)
+			if d < retryBaseDelay/2 || d >= retryBaseDelay/2+ceiling {
+				t.Fatalf("Attempt %d: backoff %s outside [%s, %s)", attempt, d, retryBaseDelay/2, retryBaseDelay/2+ceiling)
+			}
+		}
+	}
+}
+
+func TestLeaseExpiringDuringRateLimitWaitIsNotSent(t *testing.T) {
+	backend := newFakeBackend(0)
+	server := httptest.NewServer(backend.handler())
+	defer server.Close()
+
+	bot := &recordingBot{sends: make(map[string]int)}
+	cfg := &config.Config{
+		DefaultTimezone:   time.UTC,
+		SendRateGlobal:    1000,
+		SendRatePerChat:   0.5, // the second message to a chat waits two seconds
+		NotifyMaxAttempts: 5,
+	}
+	s := NewScheduler(newTestOutbox(t, bot, cfg), client.NewServerClient(server.URL, "test-secret"), newTestTemplates(t), cfg)
+
+	user := &models.User{TelegramID: 1001, FirstName: "Agent"}
+	first := backend.add(client.NotificationJob{ID: 1, Type: "DAILY_CHALLENGE", User: user})
+	second := backend.add(client.NotificationJob{ID: 2, Type: "DAILY_CHALLENGE", User: user})
+	second.LeaseExpiresAt = time.Now().Add(100 * time.Millisecond)
+
+	s.processJob(time.Now(), first)
+
+	start := time.Now()
+	s.processJob(time.Now(), second)
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Expected the send to give up at lease expiry, waited %s", elapsed)
+	}
+
+	if got := bot.sends["1001"]; got != 1 {
+		t.Errorf("Expected only the first job to be sent, got %d sends", got)
+	}
+	if update, ok := backend.update(2); ok {
+		t.Errorf("Expected no update for the job with a lapsed lease, got %+v", update)
+	}
+}
+
+func TestReclaimedJobAlreadyInOutboxIsNotResent(t *testing.T) {
+	backend := newFakeBackend(0)
+	server := httptest.NewServer(backend.handler())
+	defer server.Close()
+
+	bot := &recordingBot{sends: make(map[string]int)}
+	s := newTestScheduler(t, server.URL, bot)
+
+	user := &models.User{TelegramID: 1001, FirstName: "Agent"}
+	job := backend.add(client.NotificationJob{ID: 1, Type: "DAILY_CHALLENGE", User: user})
+	s.processJob(time.Now(), job)
+
+	// The ack was lost, so the lease lapsed and the job came back
+	job = backend.add(client.NotificationJob{ID: 1, Type: "DAILY_CHALLENGE", User: user})
+	s.processJob(time.Now(), job)
+
+	if got := bot.sends["1001"]; got != 1 {
+		t.Errorf("Expected exactly 1 send, got %d", got)
+	}
+	if update, _ := backend.update(1); update.Status != client.JobStatusSent {
+		t.Errorf("Expected status SENT, got %q", update.Status)
+	}
+}
+
+func TestSentJobReportsVariant(t *testing.T) {
+	backend := newFakeBackend(0)
+	server := httptest.NewServer(backend.handler())
+	defer server.Close()
+
+	path := filepath.Join(t.TempDir(), "experiments.json")
+	os.WriteFile(path, []byte(`{"experiments": [{"name": "copy", "kind": "streak", "arms": [
+		{"variant": "system_breach", "weight": 1},
+		{"variant": "surveillance", "weight": 1}
+	]}]}`), 0o644)
+	exps, err := experiments.Load(path)
+	if err != nil {
+		t.Fatalf("Failed to load experiments: %v", err)
+	}
+	templates, err := reminders.Open("", reminders.Options{Experiments: exps})
+	if err != nil {
+		t.Fatalf("Failed to load reminder templates: %v", err)
+	}
+
+	bot := &recordingBot{sends: make(map[string]int)}
+	cfg := &config.Config{
+		DefaultTimezone:   time.UTC,
+		SendRateGlobal:    1000,
+		SendRatePerChat:   1000,
+		NotifyMaxAttempts: 5,
+	}
+	s := NewScheduler(newTestOutbox(t, bot, cfg), client.NewServerClient(server.URL, "test-secret"), templates, cfg)
+
+	streaker := &models.User{TelegramID: 1001, FirstName: "Agent", AllStreak: 5}
+	newcomer := &models.User{TelegramID: 1002, FirstName: "Agent"}
+	s.processJob(time.Now(), backend.add(client.NotificationJob{ID: 1, Type: "DAILY_CHALLENGE", User: streaker}))
+	s.processJob(time.Now(), backend.add(client.NotificationJob{ID: 2, Type: "DAILY_CHALLENGE", User: newcomer}))
+
+	_, arm, _ := exps.Assign(string(reminders.KindStreak), streaker.TelegramID)
+	update, _ := backend.update(1)
+	if update.Status != client.JobStatusSent || update.VariantID != arm.Variant || update.Experiment != "copy" {
+		t.Errorf("Expected SENT with %s from copy, got %+v", arm.Variant, update)
+	}
+
+	// No experiment runs on no-streak reminders, but the variant is still reported
+	update, _ = backend.update(2)
+	if update.Status != client.JobStatusSent || update.VariantID == "" || update.Experiment != "" {
+		t.Errorf("Expected SENT with a rotation variant and no experiment, got %+v", update)
+	}
+}
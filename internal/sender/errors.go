@@ -0,0 +1,97 @@
+package sender
+
+import (
+	"context"
+	"errors"
+	"net"
+	"regexp"
+
+	tele "gopkg.in/telebot.v4"
+)
+
+// Kind classifies the outcome of a Telegram send
+type Kind int
+
+const (
+	KindNone         Kind = iota // sent successfully
+	KindBlocked                  // user blocked the bot
+	KindDeactivated              // user deleted their account
+	KindChatNotFound             // chat doesn't exist or never started the bot
+	KindFloodWait                // still rate limited after waiting out RetryAfter
+	KindNetwork                  // couldn't reach Telegram
+	KindServer                   // Telegram answered with a 5xx error
+	KindOther                    // any other API error
+)
+
+// serverErrorPattern matches the status code suffix of unrecognized Telegram errors,
+// e.g. "telegram: Bad Gateway (502)"
+var serverErrorPattern = regexp.MustCompile(`\(5\d\d\)$`)
+
+// String returns the kind name used in logs
+func (k Kind) String() string {
+	switch k {
+	case KindNone:
+		return "none"
+	case KindBlocked:
+		return "blocked"
+	case KindDeactivated:
+		return "deactivated"
+	case KindChatNotFound:
+		return "chat_not_found"
+	case KindFloodWait:
+		return "flood_wait"
+	case KindNetwork:
+		return "network"
+	case KindServer:
+		return "server"
+	default:
+		return "other"
+	}
+}
+
+// Unreachable reports whether the recipient can never receive messages again
+// until they come back to the bot themselves
+func (k Kind) Unreachable() bool {
+	return k == KindBlocked || k == KindDeactivated || k == KindChatNotFound
+}
+
+// Transient reports whether the send may succeed if retried later
+func (k Kind) Transient() bool {
+	return k == KindFloodWait || k == KindNetwork || k == KindServer
+}
+
+// Classify maps an error returned by Send to a Kind
+func Classify(err error) Kind {
+	if err == nil {
+		return KindNone
+	}
+
+	var flood tele.FloodError
+	if errors.As(err, &flood) {
+		return KindFloodWait
+	}
+
+	switch {
+	case errors.Is(err, tele.ErrBlockedByUser):
+		return KindBlocked
+	case errors.Is(err, tele.ErrUserIsDeactivated):
+		return KindDeactivated
+	case errors.Is(err, tele.ErrChatNotFound), errors.Is(err, tele.ErrNotStartedByUser):
+		return KindChatNotFound
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) || errors.Is(err, context.DeadlineExceeded) {
+		return KindNetwork
+	}
+
+	var apiErr *tele.Error
+	if errors.As(err, &apiErr) && apiErr.Code >= 500 {
+		return KindServer
+	}
+	if serverErrorPattern.MatchString(err.Error()) {
+		return KindServer
+	}
+
+	return KindOther
+}
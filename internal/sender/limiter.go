@@ -0,0 +1,91 @@
+package sender
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// tokenBucket is a simple token-bucket rate limiter that can also be paused,
+// e.g. when Telegram answers with a flood-wait error.
+type tokenBucket struct {
+	mu           sync.Mutex
+	rate         float64 // tokens per second
+	burst        float64
+	tokens       float64
+	last         time.Time
+	blockedUntil time.Time
+}
+
+func newTokenBucket(rate float64, burst int) *tokenBucket {
+	if burst < 1 {
+		burst = 1
+	}
+	return &tokenBucket{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+// reserve takes a token if one is available, otherwise returns how long to wait
+func (b *tokenBucket) reserve(now time.Time) time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if now.Before(b.blockedUntil) {
+		return b.blockedUntil.Sub(now)
+	}
+
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+	b.last = now
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return 0
+	}
+
+	return time.Duration((1 - b.tokens) / b.rate * float64(time.Second))
+}
+
+// Wait blocks until a token is available or ctx is done
+func (b *tokenBucket) Wait(ctx context.Context) error {
+	for {
+		delay := b.reserve(time.Now())
+		if delay == 0 {
+			return nil
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// Pause blocks the bucket for d and drains its tokens
+func (b *tokenBucket) Pause(d time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	until := time.Now().Add(d)
+	if until.After(b.blockedUntil) {
+		b.blockedUntil = until
+	}
+	b.tokens = 0
+	b.last = until
+}
+
+// idle reports whether the bucket is full and hasn't been used since before cutoff
+func (b *tokenBucket) idle(cutoff time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.last.Before(cutoff) && b.blockedUntil.Before(cutoff)
+}
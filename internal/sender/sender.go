@@ -0,0 +1,116 @@
+package sender
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	tele "gopkg.in/telebot.v4"
+)
+
+// Telegram allows roughly 30 messages per second overall and
+// about one message per second to the same chat.
+const (
+	DefaultGlobalRate  = 30
+	DefaultPerChatRate = 1
+
+	maxFloodRetries = 3
+	chatIdleAfter   = time.Minute
+	chatPruneSize   = 1024
+)
+
+// Bot is the subset of *tele.Bot used for sending
+type Bot interface {
+	Send(to tele.Recipient, what interface{}, opts ...interface{}) (*tele.Message, error)
+}
+
+// Options configures the send limits
+type Options struct {
+	GlobalRate  float64 // messages per second across all chats
+	PerChatRate float64 // messages per second to a single chat
+}
+
+// Sender sends Telegram messages through a global and a per-chat token bucket,
+// waiting out flood-wait (429) errors instead of failing.
+type Sender struct {
+	bot         Bot
+	global      *tokenBucket
+	perChatRate float64
+
+	mu    sync.Mutex
+	chats map[string]*tokenBucket
+}
+
+// New creates a rate-limited sender
+func New(bot Bot, opts Options) *Sender {
+	if opts.GlobalRate <= 0 {
+		opts.GlobalRate = DefaultGlobalRate
+	}
+	if opts.PerChatRate <= 0 {
+		opts.PerChatRate = DefaultPerChatRate
+	}
+
+	return &Sender{
+		bot:         bot,
+		global:      newTokenBucket(opts.GlobalRate, int(opts.GlobalRate)),
+		perChatRate: opts.PerChatRate,
+		chats:       make(map[string]*tokenBucket),
+	}
+}
+
+// Send delivers a message once both rate limits allow it.
+// Flood-wait errors pause the affected bucket for RetryAfter and the send is retried.
+func (s *Sender) Send(ctx context.Context, to tele.Recipient, what interface{}, opts ...interface{}) (*tele.Message, error) {
+	chat := s.chat(to.Recipient())
+
+	for attempt := 0; ; attempt++ {
+		if err := chat.Wait(ctx); err != nil {
+			return nil, err
+		}
+		if err := s.global.Wait(ctx); err != nil {
+			return nil, err
+		}
+
+		msg, err := s.bot.Send(to, what, opts...)
+
+		var flood tele.FloodError
+		if !errors.As(err, &flood) || attempt == maxFloodRetries {
+			return msg, err
+		}
+
+		retryAfter := time.Duration(flood.RetryAfter) * time.Second
+		if retryAfter <= 0 {
+			retryAfter = time.Second
+		}
+		log.Printf("[SENDER] Flood wait for chat %s, pausing %v (attempt %d/%d)", to.Recipient(), retryAfter, attempt+1, maxFloodRetries)
+
+		// A 429 means the bot as a whole is over the limit, so hold everyone back
+		s.global.Pause(retryAfter)
+		chat.Pause(retryAfter)
+	}
+}
+
+// chat returns the bucket for a recipient, pruning idle buckets as the map grows
+func (s *Sender) chat(id string) *tokenBucket {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if b, ok := s.chats[id]; ok {
+		return b
+	}
+
+	if len(s.chats) >= chatPruneSize {
+		cutoff := time.Now().Add(-chatIdleAfter)
+		for key, b := range s.chats {
+			if b.idle(cutoff) {
+				delete(s.chats, key)
+			}
+		}
+	}
+
+	b := newTokenBucket(s.perChatRate, 1)
+	s.chats[id] = b
+	return b
+}
@@ -0,0 +1,105 @@
+package sender
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	tele "gopkg.in/telebot.v4"
+)
+
+type fakeBot struct {
+	mu    sync.Mutex
+	sends []time.Time
+}
+
+func (f *fakeBot) Send(to tele.Recipient, what interface{}, opts ...interface{}) (*tele.Message, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.sends = append(f.sends, time.Now())
+	return &tele.Message{}, nil
+}
+
+func TestSendRespectsPerChatRate(t *testing.T) {
+	bot := &fakeBot{}
+	s := New(bot, Options{GlobalRate: 100, PerChatRate: 10})
+	recipient := &tele.User{ID: 42}
+
+	start := time.Now()
+	for i := 0; i < 4; i++ {
+		if _, err := s.Send(context.Background(), recipient, "hi"); err != nil {
+			t.Fatalf("Send returned error: %v", err)
+		}
+	}
+
+	// First send is free, the next three wait ~100ms each
+	if elapsed := time.Since(start); elapsed < 250*time.Millisecond {
+		t.Errorf("Expected per-chat throttling, 4 sends took %v", elapsed)
+	}
+}
+
+func TestSendDoesNotThrottleDifferentChats(t *testing.T) {
+	bot := &fakeBot{}
+	s := New(bot, Options{GlobalRate: 100, PerChatRate: 1})
+
+	start := time.Now()
+	for i := int64(0); i < 5; i++ {
+		if _, err := s.Send(context.Background(), &tele.User{ID: i}, "hi"); err != nil {
+			t.Fatalf("Send returned error: %v", err)
+		}
+	}
+
+	if elapsed := time.Since(start); elapsed > 200*time.Millisecond {
+		t.Errorf("Expected no per-chat wait across chats, took %v", elapsed)
+	}
+}
+
+func TestSendHonorsContext(t *testing.T) {
+	bot := &fakeBot{}
+	s := New(bot, Options{GlobalRate: 100, PerChatRate: 0.1})
+	recipient := &tele.User{ID: 42}
+
+	s.Send(context.Background(), recipient, "first")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	if _, err := s.Send(ctx, recipient, "second"); err == nil {
+		t.Errorf("Expected context error while waiting for the chat limit")
+	}
+	if len(bot.sends) != 1 {
+		t.Errorf("Expected 1 send, got %d", len(bot.sends))
+	}
+}
+
+func TestClassify(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want Kind
+	}{
+		{"nil", nil, KindNone},
+		{"blocked", tele.ErrBlockedByUser, KindBlocked},
+		{"deactivated", tele.ErrUserIsDeactivated, KindDeactivated},
+		{"chat not found", tele.ErrChatNotFound, KindChatNotFound},
+		{"not started", tele.ErrNotStartedByUser, KindChatNotFound},
+		{"flood", tele.FloodError{RetryAfter: 5}, KindFloodWait},
+		{"network", fmt.Errorf("telebot: %w", &net.OpError{Op: "dial", Err: errors.New("refused")}), KindNetwork},
+		{"timeout", fmt.Errorf("telebot: %w", context.DeadlineExceeded), KindNetwork},
+		{"internal", tele.ErrInternal, KindServer},
+		{"bad gateway", errors.New("telegram: Bad Gateway (502)"), KindServer},
+		{"other", tele.ErrTooLongMessage, KindOther},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Classify(tt.err); got != tt.want {
+				t.Errorf("Classify() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,98 @@
+package timezone
+
+import (
+	"strings"
+	"time"
+)
+
+// languageZones maps Telegram language codes to the most likely IANA zone.
+// Languages spoken across many zones (en, ar, ...) are deliberately left out.
+var languageZones = map[string]string{
+	"ru":    "Europe/Moscow",
+	"pl":    "Europe/Warsaw",
+	"uk":    "Europe/Kyiv",
+	"be":    "Europe/Minsk",
+	"de":    "Europe/Berlin",
+	"fr":    "Europe/Paris",
+	"it":    "Europe/Rome",
+	"es":    "Europe/Madrid",
+	"nl":    "Europe/Amsterdam",
+	"cs":    "Europe/Prague",
+	"tr":    "Europe/Istanbul",
+	"kk":    "Asia/Almaty",
+	"uz":    "Asia/Tashkent",
+	"fa":    "Asia/Tehran",
+	"hi":    "Asia/Kolkata",
+	"id":    "Asia/Jakarta",
+	"ja":    "Asia/Tokyo",
+	"ko":    "Asia/Seoul",
+	"zh":    "Asia/Shanghai",
+	"pt-br": "America/Sao_Paulo",
+	"pt":    "Europe/Lisbon",
+}
+
+// GuessFromLanguage returns a best-effort IANA zone for a Telegram language code,
+// or an empty string when the language doesn't pin down a region.
+func GuessFromLanguage(languageCode string) string {
+	code := strings.ToLower(languageCode)
+	if zone, ok := languageZones[code]; ok {
+		return zone
+	}
+
+	// Fall back to the base language of regional codes (e.g. "de-at" -> "de")
+	if base, _, found := strings.Cut(code, "-"); found {
+		return languageZones[base]
+	}
+	return ""
+}
+
+// Load resolves an IANA zone name, returning fallback when the name is empty or unknown
+func Load(name string, fallback *time.Location) *time.Location {
+	if name == "" {
+		return fallback
+	}
+
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return fallback
+	}
+	return loc
+}
+
+// Valid reports whether name is a loadable IANA zone
+func Valid(name string) bool {
+	if name == "" || name == "Local" {
+		return false
+	}
+	_, err := time.LoadLocation(name)
+	return err == nil
+}
+
+// QuietHours is a daily local-time window, [Start, End) in hours, during which
+// notifications should not be delivered. The window may wrap past midnight.
+type QuietHours struct {
+	Start int
+	End   int
+}
+
+// Contains reports whether t falls inside the quiet window in t's location
+func (q QuietHours) Contains(t time.Time) bool {
+	if q.Start == q.End {
+		return false
+	}
+
+	h := t.Hour()
+	if q.Start < q.End {
+		return h >= q.Start && h < q.End
+	}
+	return h >= q.Start || h < q.End
+}
+
+// NextEnd returns the first moment at or after t when the quiet window ends
+func (q QuietHours) NextEnd(t time.Time) time.Time {
+	end := time.Date(t.Year(), t.Month(), t.Day(), q.End, 0, 0, 0, t.Location())
+	if !end.After(t) {
+		end = end.AddDate(0, 0, 1)
+	}
+	return end
+}
@@ -0,0 +1,62 @@
+package timezone
+
+import (
+	"testing"
+	"time"
+)
+
+func TestQuietHoursWrapsMidnight(t *testing.T) {
+	q := QuietHours{Start: 22, End: 8}
+	warsaw, _ := time.LoadLocation("Europe/Warsaw")
+
+	tests := []struct {
+		hour  int
+		quiet bool
+	}{
+		{3, true},
+		{8, false},
+		{12, false},
+		{21, false},
+		{22, true},
+		{23, true},
+	}
+
+	for _, tt := range tests {
+		local := time.Date(2025, 12, 22, tt.hour, 30, 0, 0, warsaw)
+		if got := q.Contains(local); got != tt.quiet {
+			t.Errorf("Contains(%02d:30) = %v, want %v", tt.hour, got, tt.quiet)
+		}
+	}
+}
+
+func TestQuietHoursNextEnd(t *testing.T) {
+	q := QuietHours{Start: 22, End: 8}
+	tokyo, _ := time.LoadLocation("Asia/Tokyo")
+
+	late := time.Date(2025, 12, 22, 23, 0, 0, 0, tokyo)
+	if got, want := q.NextEnd(late), time.Date(2025, 12, 23, 8, 0, 0, 0, tokyo); !got.Equal(want) {
+		t.Errorf("NextEnd(23:00) = %v, want %v", got, want)
+	}
+
+	early := time.Date(2025, 12, 22, 3, 0, 0, 0, tokyo)
+	if got, want := q.NextEnd(early), time.Date(2025, 12, 22, 8, 0, 0, 0, tokyo); !got.Equal(want) {
+		t.Errorf("NextEnd(03:00) = %v, want %v", got, want)
+	}
+}
+
+func TestGuessFromLanguage(t *testing.T) {
+	tests := map[string]string{
+		"ru":    "Europe/Moscow",
+		"pl":    "Europe/Warsaw",
+		"pt-br": "America/Sao_Paulo",
+		"de-AT": "Europe/Berlin",
+		"en":    "",
+		"":      "",
+	}
+
+	for code, want := range tests {
+		if got := GuessFromLanguage(code); got != want {
+			t.Errorf("GuessFromLanguage(%q) = %q, want %q", code, got, want)
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package webhook
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// maxBodySize caps webhook payloads read for signature verification
+const maxBodySize = 1 << 20
+
+var (
+	errMissingSignature = errors.New("missing signature")
+	errBadTimestamp     = errors.New("invalid timestamp")
+	errStaleTimestamp   = errors.New("timestamp outside allowed skew")
+	errBadSignature     = errors.New("signature mismatch")
+	errReplayed         = errors.New("request replayed")
+)
+
+// Sign returns the hex HMAC-SHA256 signature of a webhook request:
+// HMAC(secret, timestamp + "." + body). The backend sends it as X-Signature
+// together with the unix timestamp in X-Timestamp.
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// authenticator verifies signed webhook requests and remembers seen signatures
+type authenticator struct {
+	secret      string
+	maxSkew     time.Duration
+	allowLegacy bool
+	now         func() time.Time
+	seen        *nonceCache
+}
+
+func newAuthenticator(secret string, maxSkew time.Duration, allowLegacy bool) *authenticator {
+	return &authenticator{
+		secret:      secret,
+		maxSkew:     maxSkew,
+		allowLegacy: allowLegacy,
+		now:         time.Now,
+		seen:        newNonceCache(),
+	}
+}
+
+// verify checks the request signature and restores the body for the handler
+func (a *authenticator) verify(r *http.Request) error {
+	signature := r.Header.Get("X-Signature")
+	if signature == "" {
+		// Static X-Bot-Secret is kept for backends that don't sign yet
+		if a.allowLegacy && r.Header.Get("X-Bot-Secret") != "" {
+			if subtle.ConstantTimeCompare([]byte(r.Header.Get("X-Bot-Secret")), []byte(a.secret)) == 1 {
+				return nil
+			}
+			return errBadSignature
+		}
+		return errMissingSignature
+	}
+
+	timestamp, err := strconv.ParseInt(r.Header.Get("X-Timestamp"), 10, 64)
+	if err != nil {
+		return errBadTimestamp
+	}
+
+	now := a.now()
+	sent := time.Unix(timestamp, 0)
+	if sent.Before(now.Add(-a.maxSkew)) || sent.After(now.Add(a.maxSkew)) {
+		return errStaleTimestamp
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(nil, r.Body, maxBodySize))
+	if err != nil {
+		return err
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+
+	expected := Sign(a.secret, timestamp, body)
+	if !hmac.Equal([]byte(signature), []byte(expected)) {
+		return errBadSignature
+	}
+
+	// A signature can only be used once while its timestamp is still acceptable
+	if !a.seen.add(signature, sent.Add(a.maxSkew), now) {
+		return errReplayed
+	}
+
+	return nil
+}
+
+// nonceCache remembers values until they expire. Keys are also queued in the order
+// they were added, so expired ones are pruned from the front instead of scanning the map.
+type nonceCache struct {
+	mu      sync.Mutex
+	entries map[string]time.Time
+	queue   []nonceEntry
+}
+
+type nonceEntry struct {
+	key       string
+	expiresAt time.Time
+}
+
+func newNonceCache() *nonceCache {
+	return &nonceCache{entries: make(map[string]time.Time)}
+}
+
+// add stores key until expiresAt, returning false if it's already present
+func (c *nonceCache) add(key string, expiresAt, now time.Time) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// Expiry follows the request timestamp, which is only roughly in arrival order, so an
+	// expired entry can wait behind a later one for at most the skew window. The lookup
+	// below checks the expiry itself, so such an entry is never mistaken for a live one.
+	for len(c.queue) > 0 && now.After(c.queue[0].expiresAt) {
+		front := c.queue[0]
+		c.queue[0] = nonceEntry{}
+		c.queue = c.queue[1:]
+		// The key may have been added again after it expired
+		if exp, ok := c.entries[front.key]; ok && exp.Equal(front.expiresAt) {
+			delete(c.entries, front.key)
+		}
+	}
+
+	if exp, ok := c.entries[key]; ok && !now.After(exp) {
+		return false
+	}
+	c.entries[key] = expiresAt
+	c.queue = append(c.queue, nonceEntry{key: key, expiresAt: expiresAt})
+	return true
+}
@@ -0,0 +1,145 @@
+package webhook
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func signedRequest(secret string, timestamp int64, body string) *http.Request {
+	r := httptest.NewRequest("POST", "/webhook/new-user", strings.NewReader(body))
+	r.Header.Set("X-Timestamp", strconv.FormatInt(timestamp, 10))
+	r.Header.Set("X-Signature", Sign(secret, timestamp, []byte(body)))
+	return r
+}
+
+func TestVerifySignedRequest(t *testing.T) {
+	now := time.Unix(1766400000, 0)
+	auth := newAuthenticator("test-secret", 5*time.Minute, false)
+	auth.now = func() time.Time { return now }
+
+	body := `{"telegram_id":123}`
+	r := signedRequest("test-secret", now.Unix(), body)
+
+	if err := auth.verify(r); err != nil {
+		t.Fatalf("verify returned error: %v", err)
+	}
+
+	// The handler must still be able to read the body
+	restored, _ := io.ReadAll(r.Body)
+	if string(restored) != body {
+		t.Errorf("Expected body %q to be restored, got %q", body, restored)
+	}
+}
+
+func TestVerifyRejects(t *testing.T) {
+	now := time.Unix(1766400000, 0)
+	body := `{"telegram_id":123}`
+
+	tests := []struct {
+		name string
+		req  func() *http.Request
+		want error
+	}{
+		{"unsigned", func() *http.Request {
+			return httptest.NewRequest("POST", "/webhook/new-user", strings.NewReader(body))
+		}, errMissingSignature},
+		{"wrong secret", func() *http.Request {
+			return signedRequest("other-secret", now.Unix(), body)
+		}, errBadSignature},
+		{"tampered body", func() *http.Request {
+			r := signedRequest("test-secret", now.Unix(), body)
+			r.Body = io.NopCloser(strings.NewReader(`{"telegram_id":999}`))
+			return r
+		}, errBadSignature},
+		{"stale", func() *http.Request {
+			return signedRequest("test-secret", now.Add(-10*time.Minute).Unix(), body)
+		}, errStaleTimestamp},
+		{"future", func() *http.Request {
+			return signedRequest("test-secret", now.Add(10*time.Minute).Unix(), body)
+		}, errStaleTimestamp},
+		{"bad timestamp", func() *http.Request {
+			r := signedRequest("test-secret", now.Unix(), body)
+			r.Header.Set("X-Timestamp", "yesterday")
+			return r
+		}, errBadTimestamp},
+		{"legacy disabled", func() *http.Request {
+			r := httptest.NewRequest("POST", "/webhook/new-user", strings.NewReader(body))
+			r.Header.Set("X-Bot-Secret", "test-secret")
+			return r
+		}, errMissingSignature},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			auth := newAuthenticator("test-secret", 5*time.Minute, false)
+			auth.now = func() time.Time { return now }
+
+			if err := auth.verify(tt.req()); !errors.Is(err, tt.want) {
+				t.Errorf("Expected %v, got %v", tt.want, err)
+			}
+		})
+	}
+}
+
+func TestVerifyRejectsReplay(t *testing.T) {
+	now := time.Unix(1766400000, 0)
+	auth := newAuthenticator("test-secret", 5*time.Minute, false)
+	auth.now = func() time.Time { return now }
+
+	body := `{"referrer_id":111}`
+	if err := auth.verify(signedRequest("test-secret", now.Unix(), body)); err != nil {
+		t.Fatalf("First delivery rejected: %v", err)
+	}
+
+	if err := auth.verify(signedRequest("test-secret", now.Unix(), body)); !errors.Is(err, errReplayed) {
+		t.Errorf("Expected replay to be rejected, got %v", err)
+	}
+}
+
+func TestNonceCacheForgetsExpiredKeys(t *testing.T) {
+	c := newNonceCache()
+	start := time.Unix(1766400000, 0)
+
+	// A steady stream of requests, with timestamps up to a minute out of order
+	for i := 0; i < 10000; i++ {
+		now := start.Add(time.Duration(i) * time.Second)
+		sent := now.Add(-time.Duration(i%60) * time.Second)
+		if !c.add(strconv.Itoa(i), sent.Add(5*time.Minute), now) {
+			t.Fatalf("Key %d rejected as a replay", i)
+		}
+	}
+	// Five minutes of keys are live, plus at most a minute waiting behind later expiries
+	if len(c.entries) > 6*60+1 || len(c.queue) > 6*60+1 {
+		t.Errorf("Expected expired keys to be pruned, got %d entries and %d queued", len(c.entries), len(c.queue))
+	}
+
+	now := start.Add(10000 * time.Second)
+	if c.add("9999", now.Add(5*time.Minute), now) {
+		t.Error("Expected a live key to be rejected")
+	}
+	if !c.add("0", now.Add(5*time.Minute), now) {
+		t.Error("Expected an expired key to be accepted again")
+	}
+}
+
+func TestVerifyLegacySecret(t *testing.T) {
+	auth := newAuthenticator("test-secret", 5*time.Minute, true)
+
+	r := httptest.NewRequest("POST", "/webhook/referral", strings.NewReader(`{}`))
+	r.Header.Set("X-Bot-Secret", "test-secret")
+	if err := auth.verify(r); err != nil {
+		t.Errorf("Expected legacy secret to be accepted, got %v", err)
+	}
+
+	r = httptest.NewRequest("POST", "/webhook/referral", strings.NewReader(`{}`))
+	r.Header.Set("X-Bot-Secret", "wrong")
+	if err := auth.verify(r); !errors.Is(err, errBadSignature) {
+		t.Errorf("Expected wrong legacy secret to be rejected, got %v", err)
+	}
+}
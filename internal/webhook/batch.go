@@ -0,0 +1,85 @@
+package webhook
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+)
+
+// BatchRequest is the body of /webhook/batch
+type BatchRequest struct {
+	Events []Event `json:"events"`
+}
+
+// handleBatch accepts many event envelopes in one request. Each event goes through
+// the same handlers and idempotency as /webhook/events and gets its own result,
+// so one bad event doesn't reject the rest.
+func (s *Server) handleBatch(w http.ResponseWriter, r *http.Request) {
+	if !s.authenticateRequest(r) {
+		log.Printf("[WEBHOOK] Unauthorized batch from %s", r.RemoteAddr)
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req BatchRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		log.Printf("[WEBHOOK] Failed to parse batch: %v", err)
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if len(req.Events) == 0 {
+		http.Error(w, "events is required", http.StatusBadRequest)
+		return
+	}
+	if len(req.Events) > s.batchMaxEvents {
+		http.Error(w, fmt.Sprintf("too many events: %d (max %d)", len(req.Events), s.batchMaxEvents), http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	results := make([]map[string]interface{}, len(req.Events))
+	accepted, retryable := 0, false
+	for i, event := range req.Events {
+		var (
+			res      result
+			replayed bool
+		)
+		if event.Type == "" {
+			res = errorResult(http.StatusBadRequest, errors.New("type is required"))
+		} else {
+			res, replayed = s.process(event, "")
+		}
+
+		// Copy so the idempotency store's result isn't modified
+		item := map[string]interface{}{"index": i, "status": res.Status}
+		for k, v := range res.Body {
+			item[k] = v
+		}
+		if replayed {
+			item["replayed"] = true
+		}
+		results[i] = item
+
+		switch {
+		case res.Status < http.StatusMultipleChoices:
+			accepted++
+		case res.Status == http.StatusServiceUnavailable:
+			retryable = true
+		}
+	}
+
+	log.Printf("[WEBHOOK] Batch of %d events: %d accepted", len(req.Events), accepted)
+
+	if retryable {
+		w.Header().Set("Retry-After", "1")
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":  accepted == len(req.Events),
+		"accepted": accepted,
+		"rejected": len(req.Events) - accepted,
+		"results":  results,
+	})
+}
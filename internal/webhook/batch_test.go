@@ -0,0 +1,78 @@
+package webhook
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+func TestBatchReportsPerItemResults(t *testing.T) {
+	bot := &countingBot{}
+	s := newTestServer(t, bot)
+
+	// b1 was already delivered through the single-event route
+	single := `{"type":"new_user","id":"b1","payload":{"telegram_id":1,"first_name":"Neo"}}`
+	if w := post(s, "/webhook/events", single, nil); w.Code != http.StatusAccepted {
+		t.Fatalf("Expected 202, got %d: %s", w.Code, w.Body)
+	}
+
+	body := `{"events":[
+		{"type":"new_user","id":"b1","payload":{"telegram_id":1,"first_name":"Neo"}},
+		{"type":"new_user","id":"b2","payload":{"telegram_id":2,"first_name":"Trinity"}},
+		{"type":"referral","id":"b3","payload":{"referred_name":"Morpheus"}}
+	]}`
+	w := post(s, "/webhook/batch", body, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body)
+	}
+
+	var resp struct {
+		Accepted int `json:"accepted"`
+		Rejected int `json:"rejected"`
+		Results  []struct {
+			Index    int    `json:"index"`
+			Status   int    `json:"status"`
+			EventID  string `json:"event_id"`
+			Error    string `json:"error"`
+			Replayed bool   `json:"replayed"`
+		} `json:"results"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+
+	if resp.Accepted != 2 || resp.Rejected != 1 {
+		t.Errorf("Expected 2 accepted and 1 rejected, got %d and %d", resp.Accepted, resp.Rejected)
+	}
+	if len(resp.Results) != 3 {
+		t.Fatalf("Expected 3 results, got %d", len(resp.Results))
+	}
+	if r := resp.Results[0]; r.Status != http.StatusAccepted || !r.Replayed {
+		t.Errorf("Expected b1 to replay the original result, got %+v", r)
+	}
+	if r := resp.Results[1]; r.Status != http.StatusAccepted || r.EventID != "b2" {
+		t.Errorf("Expected b2 to be accepted, got %+v", r)
+	}
+	if r := resp.Results[2]; r.Index != 2 || r.Status != http.StatusBadRequest || r.Error != "referrer_id is required" {
+		t.Errorf("Expected b3 to be rejected, got %+v", r)
+	}
+
+	drain(t, s)
+	if got := bot.count(); got != 2 {
+		t.Errorf("Expected 2 messages (b1 once, b2), got %d", got)
+	}
+}
+
+func TestBatchCap(t *testing.T) {
+	s := newTestServer(t, &countingBot{})
+
+	event := `{"type":"new_user","payload":{"telegram_id":1}}`
+	body := `{"events":[` + event + `,` + event + `,` + event + `,` + event + `]}`
+	if w := post(s, "/webhook/batch", body, nil); w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected 413 over the cap, got %d", w.Code)
+	}
+
+	if w := post(s, "/webhook/batch", `{"events":[]}`, nil); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an empty batch, got %d", w.Code)
+	}
+}
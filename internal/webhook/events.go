@@ -0,0 +1,77 @@
+package webhook
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"decodeBot/internal/outbox"
+)
+
+// Built-in event types
+const (
+	EventNewUser             = "new_user"
+	EventReferral            = "referral"
+	EventAchievementUnlocked = "achievement_unlocked"
+	EventStreakAtRisk        = "streak_at_risk"
+	EventStreakBroken        = "streak_broken"
+	EventLeaderboardOvertake = "leaderboard_overtaken"
+)
+
+// Event is the envelope the backend posts to /webhook/events
+type Event struct {
+	Type       string          `json:"type"`
+	ID         string          `json:"id"`
+	OccurredAt time.Time       `json:"occurred_at"`
+	Payload    json.RawMessage `json:"payload"`
+}
+
+// EventHandler decodes and validates an event payload and returns the messages to send.
+// Errors returned here are reported to the backend as 400 Bad Request.
+type EventHandler func(event Event) ([]outbox.Message, error)
+
+// ErrUnknownEventType is returned when no handler is registered for an event type
+var ErrUnknownEventType = errors.New("unknown event type")
+
+// Registry maps event types to their handlers
+type Registry struct {
+	mu       sync.RWMutex
+	handlers map[string]EventHandler
+}
+
+// NewRegistry creates an empty event registry
+func NewRegistry() *Registry {
+	return &Registry{handlers: make(map[string]EventHandler)}
+}
+
+// Register adds a handler for an event type, replacing any existing one
+func (r *Registry) Register(eventType string, handler EventHandler) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.handlers[eventType] = handler
+}
+
+// Prepare looks up the handler for the event and validates its payload
+func (r *Registry) Prepare(event Event) ([]outbox.Message, error) {
+	r.mu.RLock()
+	handler, ok := r.handlers[event.Type]
+	r.mu.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownEventType, event.Type)
+	}
+	return handler(event)
+}
+
+// decodePayload unmarshals an event payload into v
+func decodePayload(event Event, v interface{}) error {
+	if len(event.Payload) == 0 {
+		return errors.New("payload is required")
+	}
+	if err := json.Unmarshal(event.Payload, v); err != nil {
+		return fmt.Errorf("invalid %s payload: %w", event.Type, err)
+	}
+	return nil
+}
@@ -0,0 +1,301 @@
+package webhook
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"decodeBot/internal/outbox"
+)
+
+func TestRegistryPrepare(t *testing.T) {
+	r := NewRegistry()
+
+	var got Event
+	r.Register("ping", func(event Event) ([]outbox.Message, error) {
+		got = event
+		return nil, nil
+	})
+
+	event := Event{Type: "ping", ID: "evt_1", Payload: json.RawMessage(`{}`)}
+	if _, err := r.Prepare(event); err != nil {
+		t.Fatalf("Prepare returned error: %v", err)
+	}
+	if got.ID != "evt_1" {
+		t.Errorf("Expected handler to receive evt_1, got %q", got.ID)
+	}
+
+	if _, err := r.Prepare(Event{Type: "pong"}); !errors.Is(err, ErrUnknownEventType) {
+		t.Errorf("Expected ErrUnknownEventType, got %v", err)
+	}
+}
+
+func TestEventValidation(t *testing.T) {
+	s := newTestServer(t, &countingBot{})
+
+	tests := []struct {
+		name string
+		body string
+		want string
+	}{
+		{"unknown type", `{"type":"nope","id":"e1","payload":{}}`, "unknown event type"},
+		{"missing type", `{"id":"e2","payload":{}}`, "type is required"},
+		{"missing payload", `{"type":"new_user","id":"e3"}`, "payload is required"},
+		{"malformed payload", `{"type":"new_user","id":"e4","payload":[1]}`, "invalid new_user payload"},
+		{"missing field", `{"type":"referral","id":"e5","payload":{"referred_name":"Neo"}}`, "referrer_id is required"},
+		{"unknown streak variant", `{"type":"streak_at_risk","id":"e7","payload":{"user":{"telegram_id":1},"variant":"emoji","hours_left":2}}`, "unknown variant"},
+		{"broken without length", `{"type":"streak_broken","id":"e8","payload":{"user":{"telegram_id":1}}}`, "lost_streak must be positive"},
+		{"missing achievement code", `{"type":"achievement_unlocked","id":"e6","payload":{"telegram_id":1,"title":"First Blood"}}`, "code is required"},
+		{"overtake without rank loss", `{"type":"leaderboard_overtaken","id":"e9","payload":{"telegram_id":1,"rival":{"first_name":"Smith"},"board":"daily","old_rank":3,"new_rank":3}}`, "new_rank must be below old_rank"},
+		{"unknown board", `{"type":"leaderboard_overtaken","id":"e10","payload":{"telegram_id":1,"rival":{"first_name":"Smith"},"board":"weekly","old_rank":3,"new_rank":4}}`, "unknown board"},
+		{"malformed envelope", `{"type":`, "Invalid request body"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := post(s, "/webhook/events", tt.body, nil)
+			if w.Code != http.StatusBadRequest {
+				t.Errorf("Expected 400, got %d", w.Code)
+			}
+			if !strings.Contains(w.Body.String(), tt.want) {
+				t.Errorf("Expected %q in response, got %s", tt.want, w.Body)
+			}
+		})
+	}
+}
+
+func TestLegacyRouteAdapter(t *testing.T) {
+	s := newTestServer(t, &countingBot{})
+
+	var got Event
+	s.RegisterEvent(EventReferral, func(event Event) ([]outbox.Message, error) {
+		got = event
+		return nil, nil
+	})
+
+	body := `{"referrer_id":42,"referred_name":"Trinity"}`
+	if w := post(s, "/webhook/referral", body, nil); w.Code >= 300 {
+		t.Fatalf("Expected success, got %d: %s", w.Code, w.Body)
+	}
+
+	if got.Type != EventReferral {
+		t.Errorf("Expected type %q, got %q", EventReferral, got.Type)
+	}
+	if string(got.Payload) != body {
+		t.Errorf("Expected the request body as payload, got %s", got.Payload)
+	}
+	if got.OccurredAt.IsZero() {
+		t.Errorf("Expected occurred_at to be set")
+	}
+}
+
+func TestAchievementUnlockedEvent(t *testing.T) {
+	bot := &countingBot{}
+	s := newTestServer(t, bot)
+
+	body := `{"type":"achievement_unlocked","id":"evt_ach","payload":{"telegram_id":123,"first_name":"Neo","code":"first_blood","title":"First Blood","rarity":"epic","shards_awarded":50}}`
+	if w := post(s, "/webhook/events", body, nil); w.Code != http.StatusAccepted {
+		t.Fatalf("Expected 202, got %d: %s", w.Code, w.Body)
+	}
+	drain(t, s)
+
+	for _, want := range []string{"Neo", "First Blood", "🟣 EPIC", "+50 Shards"} {
+		if !strings.Contains(bot.last, want) {
+			t.Errorf("Expected %q in message, got:\n%s", want, bot.last)
+		}
+	}
+
+	if bot.markup == nil || len(bot.markup.InlineKeyboard) == 0 {
+		t.Fatal("Expected an inline keyboard")
+	}
+	button := bot.markup.InlineKeyboard[0][0]
+	if button.WebApp == nil || !strings.Contains(button.WebApp.URL, "screen=achievements") || !strings.Contains(button.WebApp.URL, "achievement=first_blood") {
+		t.Errorf("Expected a Mini App deep link to the achievement, got %+v", button)
+	}
+}
+
+func TestStreakEvents(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want []string
+	}{
+		{
+			"variant at risk",
+			`{"type":"streak_at_risk","id":"s1","payload":{"user":{"telegram_id":1,"first_name":"Neo","hex_streak":7,"word_streak":3},"variant":"hex","hours_left":3}}`,
+			[]string{"Neo", "7", "HEX", "3 hours", "HEX 7 · WORD 3"},
+		},
+		{
+			"daily streak at risk",
+			`{"type":"streak_at_risk","id":"s2","payload":{"user":{"telegram_id":1,"first_name":"Neo","all_streak":12},"hours_left":1}}`,
+			[]string{"12", "DAILY", "1 hour"},
+		},
+		{
+			"streak broken",
+			`{"type":"streak_broken","id":"s3","payload":{"user":{"telegram_id":1,"first_name":"Neo","numeric_streak":4},"variant":"word","lost_streak":21}}`,
+			[]string{"Neo", "21", "WORD", "NUMERIC 4"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bot := &countingBot{}
+			s := newTestServer(t, bot)
+
+			if w := post(s, "/webhook/events", tt.body, nil); w.Code != http.StatusAccepted {
+				t.Fatalf("Expected 202, got %d: %s", w.Code, w.Body)
+			}
+			drain(t, s)
+
+			for _, want := range tt.want {
+				if !strings.Contains(bot.last, want) {
+					t.Errorf("Expected %q in message, got:\n%s", want, bot.last)
+				}
+			}
+		})
+	}
+}
+
+func TestStreakAtRiskWithoutStreakIsSkipped(t *testing.T) {
+	bot := &countingBot{}
+	s := newTestServer(t, bot)
+
+	body := `{"type":"streak_at_risk","id":"s4","payload":{"user":{"telegram_id":1,"hex_streak":5},"variant":"word","hours_left":2}}`
+	if w := post(s, "/webhook/events", body, nil); w.Code != http.StatusAccepted {
+		t.Fatalf("Expected 202, got %d: %s", w.Code, w.Body)
+	}
+	waitForState(t, s, "s4", StateSkipped)
+
+	if got := bot.count(); got != 0 {
+		t.Errorf("Expected no message without an active streak, got %d", got)
+	}
+}
+
+func TestLeaderboardOvertakesAreThrottled(t *testing.T) {
+	bot := &countingBot{}
+	s := newTestServer(t, bot)
+	s.overtakes = newOvertakeThrottle(100*time.Millisecond, s.sendOvertakeSummary)
+
+	overtakes := []struct{ id, rival, ranks string }{
+		{"o1", "Trinity", `"old_rank":2,"new_rank":3`},
+		{"o2", "Morpheus", `"old_rank":3,"new_rank":4`},
+		{"o3", "Smith", `"old_rank":4,"new_rank":5`},
+	}
+	for _, o := range overtakes {
+		body := fmt.Sprintf(`{"type":"leaderboard_overtaken","id":%q,"payload":{"telegram_id":1,"first_name":"Neo","rival":{"telegram_id":2,"first_name":%q},"board":"daily","variant":"hex",%s}}`, o.id, o.rival, o.ranks)
+		if w := post(s, "/webhook/events", body, nil); w.Code != http.StatusAccepted {
+			t.Fatalf("Expected 202, got %d: %s", w.Code, w.Body)
+		}
+	}
+
+	waitForState(t, s, "o1", StateDelivered)
+	waitForState(t, s, "o2", StateSkipped)
+	waitForState(t, s, "o3", StateSkipped)
+
+	if got := bot.count(); got != 1 {
+		t.Fatalf("Expected only the first overtake to be sent right away, got %d", got)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for bot.count() < 2 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	drain(t, s)
+
+	if got := bot.count(); got != 2 {
+		t.Fatalf("Expected one summary after the window, got %d sends", got)
+	}
+	for _, want := range []string{"Neo", "Morpheus and Smith", "DAILY HEX: #3 → #5"} {
+		if !strings.Contains(bot.last, want) {
+			t.Errorf("Expected %q in summary, got:\n%s", want, bot.last)
+		}
+	}
+	if bot.markup == nil || !strings.Contains(bot.markup.InlineKeyboard[0][0].WebApp.URL, "screen=leaderboard") {
+		t.Errorf("Expected a Mini App link to the leaderboard, got %+v", bot.markup)
+	}
+}
+
+func TestRefusedOvertakeDoesNotOpenWindow(t *testing.T) {
+	bot := &countingBot{release: make(chan struct{})}
+	s := newTestServer(t, bot)
+
+	// Fill the outbox so the overtake is refused
+	accepted := 0
+	for i := 0; i < 20; i++ {
+		body := fmt.Sprintf(`{"type":"new_user","id":"fill_%d","payload":{"telegram_id":%d}}`, i, 100+i)
+		if w := post(s, "/webhook/events", body, nil); w.Code == http.StatusAccepted {
+			accepted++
+		}
+	}
+
+	body := `{"type":"leaderboard_overtaken","id":"o1","payload":{"telegram_id":1,"first_name":"Neo","rival":{"telegram_id":2,"first_name":"Trinity"},"board":"daily","old_rank":2,"new_rank":3}}`
+	if w := post(s, "/webhook/events", body, nil); w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("Expected 503 with a full outbox, got %d: %s", w.Code, w.Body)
+	}
+
+	close(bot.release)
+	deadline := time.Now().Add(2 * time.Second)
+	for bot.count() < accepted && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	// The backend's retry is sent right away instead of waiting for a summary
+	if w := postAt(s, time.Now().Add(time.Second), "/webhook/events", body, nil); w.Code != http.StatusAccepted {
+		t.Fatalf("Expected the retry to be accepted, got %d: %s", w.Code, w.Body)
+	}
+	waitForState(t, s, "o1", StateDelivered)
+	if !strings.Contains(bot.last, "Trinity") {
+		t.Errorf("Expected the overtake notification, got:\n%s", bot.last)
+	}
+}
+
+func TestEventsRenderInUserLanguage(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want []string
+	}{
+		{
+			"polish streak broken",
+			`{"type":"streak_broken","id":"l1","payload":{"user":{"telegram_id":1,"first_name":"Neo","numeric_streak":4,"language_code":"pl"},"variant":"word","lost_streak":21}}`,
+			[]string{"Neo", "21", "WORD", "Nadal aktywne: 🔥 NUMERIC 4"},
+		},
+		{
+			"russian welcome",
+			`{"type":"new_user","id":"l2","payload":{"telegram_id":1,"first_name":"Нео","language_code":"ru-RU"}}`,
+			[]string{"Добро пожаловать в DEC0D3, Нео!"},
+		},
+		{
+			"russian referral",
+			`{"type":"referral","id":"l3","payload":{"referrer_id":1,"referred_name":"Trinity","referrer_language_code":"ru"}}`,
+			[]string{"<b>Trinity</b>", "+20 осколков"},
+		},
+		{
+			"unsupported language falls back to english",
+			`{"type":"achievement_unlocked","id":"l4","payload":{"telegram_id":1,"first_name":"Neo","code":"c","title":"T","rarity":"rare","language_code":"de"}}`,
+			[]string{"🔵 RARE", "View your trophy wall"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bot := &countingBot{}
+			s := newTestServer(t, bot)
+
+			if w := post(s, "/webhook/events", tt.body, nil); w.Code != http.StatusAccepted {
+				t.Fatalf("Expected 202, got %d: %s", w.Code, w.Body)
+			}
+			drain(t, s)
+
+			for _, want := range tt.want {
+				if !strings.Contains(bot.last, want) {
+					t.Errorf("Expected %q in message, got:\n%s", want, bot.last)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,283 @@
+package webhook
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"decodeBot/internal/bot"
+	"decodeBot/internal/i18n"
+	"decodeBot/internal/models"
+	"decodeBot/internal/outbox"
+)
+
+// NewUserRequest represents the request payload for new user notifications
+type NewUserRequest struct {
+	TelegramID   int64  `json:"telegram_id"`
+	FirstName    string `json:"first_name"`
+	LanguageCode string `json:"language_code"`
+}
+
+// ReferralNotificationRequest represents the request payload for referral notifications
+type ReferralNotificationRequest struct {
+	ReferrerID           int64  `json:"referrer_id"`
+	ReferredName         string `json:"referred_name"`
+	ReferrerLanguageCode string `json:"referrer_language_code"`
+}
+
+// registerBuiltinEvents registers the handlers for events the bot ships with
+func (s *Server) registerBuiltinEvents() {
+	s.events.Register(EventNewUser, s.newUserEvent)
+	s.events.Register(EventReferral, s.referralEvent)
+	s.events.Register(EventAchievementUnlocked, s.achievementUnlockedEvent)
+	s.events.Register(EventStreakAtRisk, s.streakAtRiskEvent)
+	s.events.Register(EventStreakBroken, s.streakBrokenEvent)
+	s.events.Register(EventLeaderboardOvertake, s.leaderboardOvertakenEvent)
+}
+
+// newUserEvent welcomes a user who just signed up in the Mini App
+func (s *Server) newUserEvent(event Event) ([]outbox.Message, error) {
+	var req NewUserRequest
+	if err := decodePayload(event, &req); err != nil {
+		return nil, err
+	}
+
+	if req.TelegramID == 0 {
+		return nil, errors.New("telegram_id is required")
+	}
+
+	log.Printf("[WEBHOOK] Received new user notification: TG ID %d (@%s)", req.TelegramID, req.FirstName)
+
+	loc := i18n.Resolve(req.LanguageCode)
+	return []outbox.Message{{
+		ChatID:    req.TelegramID,
+		Text:      bot.GetWelcomeMessage(loc, req.FirstName),
+		ParseMode: bot.ParseMode,
+		Markup:    bot.GetMainMenu(loc, s.miniAppURL),
+	}}, nil
+}
+
+// referralEvent tells a referrer that their invite was used
+func (s *Server) referralEvent(event Event) ([]outbox.Message, error) {
+	var req ReferralNotificationRequest
+	if err := decodePayload(event, &req); err != nil {
+		return nil, err
+	}
+
+	if req.ReferrerID == 0 {
+		return nil, errors.New("referrer_id is required")
+	}
+
+	log.Printf("[WEBHOOK] Received referral notification: Referrer %d, Referred %s", req.ReferrerID, req.ReferredName)
+
+	return []outbox.Message{{
+		ChatID:    req.ReferrerID,
+		Text:      bot.GetReferralMessage(i18n.Resolve(req.ReferrerLanguageCode), req.ReferredName),
+		ParseMode: bot.ParseMode,
+	}}, nil
+}
+
+// AchievementUnlockedRequest represents the payload of an achievement_unlocked event
+type AchievementUnlockedRequest struct {
+	TelegramID    int64  `json:"telegram_id"`
+	FirstName     string `json:"first_name"`
+	Code          string `json:"code"`
+	Title         string `json:"title"`
+	Rarity        string `json:"rarity"`
+	ShardsAwarded int    `json:"shards_awarded"`
+	LanguageCode  string `json:"language_code"`
+}
+
+// achievementUnlockedEvent congratulates a user on a new achievement
+func (s *Server) achievementUnlockedEvent(event Event) ([]outbox.Message, error) {
+	var req AchievementUnlockedRequest
+	if err := decodePayload(event, &req); err != nil {
+		return nil, err
+	}
+
+	switch {
+	case req.TelegramID == 0:
+		return nil, errors.New("telegram_id is required")
+	case req.Code == "":
+		return nil, errors.New("code is required")
+	case req.Title == "":
+		return nil, errors.New("title is required")
+	case req.ShardsAwarded < 0:
+		return nil, errors.New("shards_awarded must not be negative")
+	}
+
+	log.Printf("[WEBHOOK] Received achievement notification: TG ID %d unlocked %s (%s)", req.TelegramID, req.Code, req.Rarity)
+
+	loc := i18n.Resolve(req.LanguageCode)
+	return []outbox.Message{{
+		ChatID:    req.TelegramID,
+		Text:      bot.GetAchievementMessage(loc, req.FirstName, req.Title, req.Rarity, req.ShardsAwarded),
+		ParseMode: bot.ParseMode,
+		Markup:    bot.GetAchievementMenu(loc, s.miniAppURL, req.Code),
+	}}, nil
+}
+
+// StreakAtRiskRequest represents the payload of a streak_at_risk event.
+// An empty variant refers to the overall daily streak.
+type StreakAtRiskRequest struct {
+	User      models.User `json:"user"`
+	Variant   string      `json:"variant"`
+	HoursLeft int         `json:"hours_left"`
+}
+
+// StreakBrokenRequest represents the payload of a streak_broken event.
+// An empty variant refers to the overall daily streak.
+type StreakBrokenRequest struct {
+	User       models.User `json:"user"`
+	Variant    string      `json:"variant"`
+	LostStreak int         `json:"lost_streak"`
+}
+
+// streakAtRiskEvent warns a user that a streak is about to reset
+func (s *Server) streakAtRiskEvent(event Event) ([]outbox.Message, error) {
+	var req StreakAtRiskRequest
+	if err := decodePayload(event, &req); err != nil {
+		return nil, err
+	}
+
+	switch {
+	case req.User.TelegramID == 0:
+		return nil, errors.New("user.telegram_id is required")
+	case !bot.ValidVariant(req.Variant):
+		return nil, fmt.Errorf("unknown variant %q", req.Variant)
+	case req.HoursLeft < 0:
+		return nil, errors.New("hours_left must not be negative")
+	}
+
+	// The streak may have been extended since the backend checked; nothing left to lose
+	if bot.StreakFor(&req.User, req.Variant) == 0 {
+		log.Printf("[WEBHOOK] Skipping streak warning for %d: no active %s streak", req.User.TelegramID, req.Variant)
+		return nil, nil
+	}
+
+	log.Printf("[WEBHOOK] Received streak warning: TG ID %d, %d hours left", req.User.TelegramID, req.HoursLeft)
+
+	loc := i18n.Resolve(req.User.LanguageCode)
+	return []outbox.Message{{
+		ChatID:    req.User.TelegramID,
+		Text:      bot.GetStreakAtRiskMessage(loc, &req.User, req.Variant, req.HoursLeft),
+		ParseMode: bot.ParseMode,
+		Markup:    bot.GetMainMenu(loc, s.miniAppURL),
+	}}, nil
+}
+
+// streakBrokenEvent tells a user a streak was lost and invites them back
+func (s *Server) streakBrokenEvent(event Event) ([]outbox.Message, error) {
+	var req StreakBrokenRequest
+	if err := decodePayload(event, &req); err != nil {
+		return nil, err
+	}
+
+	switch {
+	case req.User.TelegramID == 0:
+		return nil, errors.New("user.telegram_id is required")
+	case !bot.ValidVariant(req.Variant):
+		return nil, fmt.Errorf("unknown variant %q", req.Variant)
+	case req.LostStreak <= 0:
+		return nil, errors.New("lost_streak must be positive")
+	}
+
+	log.Printf("[WEBHOOK] Received streak broken notice: TG ID %d lost %d days", req.User.TelegramID, req.LostStreak)
+
+	loc := i18n.Resolve(req.User.LanguageCode)
+	return []outbox.Message{{
+		ChatID:    req.User.TelegramID,
+		Text:      bot.GetStreakBrokenMessage(loc, &req.User, req.Variant, req.LostStreak),
+		ParseMode: bot.ParseMode,
+		Markup:    bot.GetMainMenu(loc, s.miniAppURL),
+	}}, nil
+}
+
+// LeaderboardRival is the user who moved past the recipient
+type LeaderboardRival struct {
+	TelegramID int64  `json:"telegram_id"`
+	FirstName  string `json:"first_name"`
+}
+
+// LeaderboardOvertakenRequest represents the payload of a leaderboard_overtaken event.
+// An empty variant refers to the combined board.
+type LeaderboardOvertakenRequest struct {
+	TelegramID   int64            `json:"telegram_id"`
+	FirstName    string           `json:"first_name"`
+	LanguageCode string           `json:"language_code"`
+	Rival        LeaderboardRival `json:"rival"`
+	Board        string           `json:"board"`
+	Variant      string           `json:"variant"`
+	OldRank      int              `json:"old_rank"`
+	NewRank      int              `json:"new_rank"`
+}
+
+// leaderboardOvertakenEvent taunts a user who was passed on a leaderboard.
+// Overtakes inside the throttle window are collapsed into one later summary; the window
+// opens only once accept has enqueued the notification (see overtakeThrottle.Settle).
+func (s *Server) leaderboardOvertakenEvent(event Event) ([]outbox.Message, error) {
+	var req LeaderboardOvertakenRequest
+	if err := decodePayload(event, &req); err != nil {
+		return nil, err
+	}
+
+	switch {
+	case req.TelegramID == 0:
+		return nil, errors.New("telegram_id is required")
+	case req.Rival.FirstName == "":
+		return nil, errors.New("rival.first_name is required")
+	case !bot.ValidBoard(req.Board):
+		return nil, fmt.Errorf("unknown board %q", req.Board)
+	case !bot.ValidVariant(req.Variant):
+		return nil, fmt.Errorf("unknown variant %q", req.Variant)
+	case req.OldRank < 1 || req.NewRank <= req.OldRank:
+		return nil, errors.New("new_rank must be below old_rank")
+	}
+
+	overtake := bot.Overtake{
+		RivalName: req.Rival.FirstName,
+		Board:     req.Board,
+		Variant:   req.Variant,
+		OldRank:   req.OldRank,
+		NewRank:   req.NewRank,
+	}
+
+	to := overtakeRecipient{FirstName: req.FirstName, LanguageCode: req.LanguageCode}
+	if !s.overtakes.Allow(req.TelegramID, to, overtake, event.ID) {
+		log.Printf("[WEBHOOK] Throttled overtake notification for %d, adding to summary", req.TelegramID)
+		return nil, nil
+	}
+
+	log.Printf("[WEBHOOK] Received overtake notification: TG ID %d passed by %d on %s board", req.TelegramID, req.Rival.TelegramID, req.Board)
+
+	loc := i18n.Resolve(req.LanguageCode)
+	return []outbox.Message{{
+		ChatID:    req.TelegramID,
+		Text:      bot.GetOvertakenMessage(loc, req.FirstName, overtake),
+		ParseMode: bot.ParseMode,
+		Markup:    bot.GetLeaderboardMenu(loc, s.miniAppURL, req.Board, req.Variant),
+	}}, nil
+}
+
+// sendOvertakeSummary sends the overtakes collected during a throttle window
+func (s *Server) sendOvertakeSummary(chatID int64, to overtakeRecipient, overtakes []bot.Overtake) {
+	loc := i18n.Resolve(to.LanguageCode)
+	last := overtakes[len(overtakes)-1]
+	msg := outbox.Message{
+		ID:        fmt.Sprintf("leaderboard:%d:%d", chatID, time.Now().UnixNano()),
+		ChatID:    chatID,
+		Text:      bot.GetOvertakenSummaryMessage(loc, to.FirstName, overtakes),
+		ParseMode: bot.ParseMode,
+		Markup:    bot.GetLeaderboardMenu(loc, s.miniAppURL, last.Board, last.Variant),
+	}
+
+	err := s.outbox.Enqueue(msg, func(err error) {
+		if err != nil {
+			log.Printf("[WEBHOOK] Failed to send overtake summary to %d: %v", chatID, err)
+		}
+	})
+	if err != nil {
+		log.Printf("[WEBHOOK] Dropping overtake summary for %d: %v", chatID, err)
+	}
+}
@@ -0,0 +1,116 @@
+package webhook
+
+import (
+	"container/list"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// result is the outcome of processing an event, replayed verbatim for duplicate deliveries
+type result struct {
+	Status int
+	Body   map[string]interface{}
+}
+
+// idempotencyStore remembers results by idempotency key for a bounded time and size.
+// Concurrent requests with the same key wait for the first one instead of re-running it.
+type idempotencyStore struct {
+	mu         sync.Mutex
+	ttl        time.Duration
+	maxEntries int
+	entries    map[string]*list.Element
+	order      *list.List // oldest first
+	now        func() time.Time
+}
+
+type idempotencyEntry struct {
+	key       string
+	expiresAt time.Time
+	done      chan struct{}
+	result    result
+}
+
+func newIdempotencyStore(ttl time.Duration, maxEntries int) *idempotencyStore {
+	return &idempotencyStore{
+		ttl:        ttl,
+		maxEntries: maxEntries,
+		entries:    make(map[string]*list.Element),
+		order:      list.New(),
+		now:        time.Now,
+	}
+}
+
+// Do runs fn once per key and returns its result; replayed reports whether the
+// result came from an earlier delivery. Only successful results are kept so
+// failed deliveries can be retried by the backend.
+func (s *idempotencyStore) Do(key string, fn func() result) (res result, replayed bool) {
+	if key == "" {
+		return fn(), false
+	}
+
+	s.mu.Lock()
+	s.evictExpired()
+
+	if el, ok := s.entries[key]; ok {
+		entry := el.Value.(*idempotencyEntry)
+		s.mu.Unlock()
+		<-entry.done
+		return entry.result, true
+	}
+
+	entry := &idempotencyEntry{
+		key:       key,
+		expiresAt: s.now().Add(s.ttl),
+		done:      make(chan struct{}),
+	}
+	s.entries[key] = s.order.PushBack(entry)
+	for s.order.Len() > s.maxEntries {
+		s.remove(s.order.Front())
+	}
+	s.mu.Unlock()
+
+	entry.result = fn()
+	close(entry.done)
+
+	if entry.result.Status >= http.StatusMultipleChoices {
+		s.mu.Lock()
+		if el, ok := s.entries[key]; ok && el.Value == entry {
+			s.remove(el)
+		}
+		s.mu.Unlock()
+	}
+
+	return entry.result, false
+}
+
+// evictExpired drops entries past their TTL; callers must hold mu
+func (s *idempotencyStore) evictExpired() {
+	now := s.now()
+	for el := s.order.Front(); el != nil; el = s.order.Front() {
+		if el.Value.(*idempotencyEntry).expiresAt.After(now) {
+			return
+		}
+		s.remove(el)
+	}
+}
+
+// remove deletes an entry; callers must hold mu
+func (s *idempotencyStore) remove(el *list.Element) {
+	s.order.Remove(el)
+	delete(s.entries, el.Value.(*idempotencyEntry).key)
+}
+
+// Forget drops a completed key so the next delivery with it runs again
+func (s *idempotencyStore) Forget(key string) {
+	if key == "" {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if el, ok := s.entries[key]; ok {
+		s.remove(el)
+	}
+}
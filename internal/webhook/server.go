@@ -1,170 +1,371 @@
 package webhook
 
 import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
-	"os"
+	"sync"
+	"time"
 
-	"decodeBot/internal/bot"
-
-	tele "gopkg.in/telebot.v4"
+	"decodeBot/internal/config"
+	"decodeBot/internal/outbox"
 )
 
+// idempotencyMaxEntries bounds the number of remembered event results
+const idempotencyMaxEntries = 10000
+
 // Server represents the webhook HTTP server
 type Server struct {
-	bot       *tele.Bot
-	botSecret string
-	port      string
+	outbox     *outbox.Outbox
+	botSecret  string
+	port       string
+	miniAppURL string
+	mux        *http.ServeMux
+	httpServer *http.Server
+
+	auth                 *authenticator
+	allowUnauthenticated bool
+
+	events      *Registry
+	idempotency *idempotencyStore
+	statuses    *statusStore
+	overtakes   *overtakeThrottle
+
+	batchMaxEvents int
 }
 
-// NewServer creates a new webhook server
-func NewServer(bot *tele.Bot, port string) *Server {
-	botSecret := os.Getenv("BOT_SECRET")
-	return &Server{
-		bot:       bot,
-		botSecret: botSecret,
-		port:      port,
+// NewServer creates a new webhook server that sends through the given outbox
+func NewServer(out *outbox.Outbox, cfg *config.Config) *Server {
+	s := &Server{
+		outbox:     out,
+		botSecret:  cfg.BotSecret,
+		port:       cfg.WebhookPort,
+		miniAppURL: cfg.MiniAppURL,
+		mux:        http.NewServeMux(),
+
+		auth:                 newAuthenticator(cfg.BotSecret, cfg.WebhookMaxSkew, cfg.WebhookAllowLegacySecret),
+		allowUnauthenticated: cfg.WebhookAllowUnauthenticated,
+
+		events:      NewRegistry(),
+		idempotency: newIdempotencyStore(cfg.WebhookIdempotencyTTL, idempotencyMaxEntries),
+		statuses:    newStatusStore(statusTTL, statusMaxEntries),
+
+		batchMaxEvents: cfg.WebhookBatchMaxEvents,
 	}
+	s.overtakes = newOvertakeThrottle(cfg.LeaderboardThrottle, s.sendOvertakeSummary)
+	s.registerBuiltinEvents()
+	s.registerRoutes()
+	return s
+}
+
+// registerRoutes mounts the webhook endpoints on the server mux
+func (s *Server) registerRoutes() {
+	s.mux.HandleFunc("POST /webhook/events", s.handleEvent)
+	s.mux.HandleFunc("GET /webhook/events/{id}", s.handleEventStatus)
+	s.mux.HandleFunc("POST /webhook/batch", s.handleBatch)
+
+	// Pre-envelope routes kept for older backends
+	s.mux.HandleFunc("/webhook/new-user", s.legacyRoute(EventNewUser))
+	s.mux.HandleFunc("/webhook/referral", s.legacyRoute(EventReferral))
+
+	// Health check endpoint
+	s.mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("OK"))
+	})
 }
 
-// NewUserRequest represents the request payload for new user notifications
-type NewUserRequest struct {
-	TelegramID int64  `json:"telegram_id"`
-	FirstName  string `json:"first_name"`
+// RegisterEvent adds a handler for an event type accepted on /webhook/events
+func (s *Server) RegisterEvent(eventType string, handler EventHandler) {
+	s.events.Register(eventType, handler)
 }
 
-// ReferralNotificationRequest represents the request payload for referral notifications
-type ReferralNotificationRequest struct {
-	ReferrerID   int64  `json:"referrer_id"`
-	ReferredName string `json:"referred_name"`
+// Handle mounts an extra handler on the webhook listener, e.g. Telegram updates
+// in webhook mode. Must be called before Start.
+func (s *Server) Handle(pattern string, handler http.Handler) {
+	s.mux.Handle(pattern, handler)
 }
 
-// authenticateRequest checks if the request has the correct bot secret
+// authenticateRequest verifies the request's HMAC signature (see Sign)
 func (s *Server) authenticateRequest(r *http.Request) bool {
 	if s.botSecret == "" {
-		// No secret configured, skip authentication
+		// Only reachable when explicitly allowed with WEBHOOK_ALLOW_UNAUTHENTICATED
 		return true
 	}
 
-	providedSecret := r.Header.Get("X-Bot-Secret")
-	return providedSecret == s.botSecret
+	if err := s.auth.verify(r); err != nil {
+		log.Printf("[WEBHOOK] Authentication failed for %s %s: %v", r.Method, r.URL.Path, err)
+		return false
+	}
+	return true
 }
 
-// handleNewUser handles incoming new user notifications from the backend
-func (s *Server) handleNewUser(w http.ResponseWriter, r *http.Request) {
-	// Authenticate request
+// handleEvent receives a typed event envelope and dispatches it to the registered handler
+func (s *Server) handleEvent(w http.ResponseWriter, r *http.Request) {
 	if !s.authenticateRequest(r) {
-		log.Printf("[WEBHOOK] Unauthorized new user notification from %s", r.RemoteAddr)
+		log.Printf("[WEBHOOK] Unauthorized event from %s", r.RemoteAddr)
 		http.Error(w, "Unauthorized", http.StatusUnauthorized)
 		return
 	}
 
-	// Parse request body
-	var req NewUserRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		log.Printf("[WEBHOOK] Failed to parse new user request: %v", err)
+	var event Event
+	if err := json.NewDecoder(r.Body).Decode(&event); err != nil {
+		log.Printf("[WEBHOOK] Failed to parse event: %v", err)
 		http.Error(w, "Invalid request body", http.StatusBadRequest)
 		return
 	}
 
-	// Validate request
-	if req.TelegramID == 0 {
-		log.Printf("[WEBHOOK] Missing telegram_id in request")
-		http.Error(w, "telegram_id is required", http.StatusBadRequest)
+	if event.Type == "" {
+		http.Error(w, "type is required", http.StatusBadRequest)
 		return
 	}
 
-	log.Printf("[WEBHOOK] Received new user notification: TG ID %d (@%s)", req.TelegramID, req.FirstName)
+	s.dispatch(w, r, event)
+}
 
-	// Send welcome message
-	message := bot.GetWelcomeMessage(req.FirstName)
-	menu := bot.GetMainMenu()
+// legacyRoute adapts a pre-envelope endpoint: the whole body becomes the payload of eventType.
+// These routes carry no event ID, so without an Idempotency-Key header the event is
+// identified by its body, and a retried delivery is recognized as the same event.
+func (s *Server) legacyRoute(eventType string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !s.authenticateRequest(r) {
+			log.Printf("[WEBHOOK] Unauthorized %s notification from %s", eventType, r.RemoteAddr)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
 
-	recipient := &tele.User{ID: req.TelegramID}
-	if _, err := s.bot.Send(recipient, message, menu); err != nil {
-		log.Printf("[WEBHOOK] Failed to send welcome message to user %d: %v", req.TelegramID, err)
-		http.Error(w, fmt.Sprintf("Failed to send message: %v", err), http.StatusInternalServerError)
-		return
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBodySize))
+		if err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		event := Event{
+			Type:       eventType,
+			OccurredAt: time.Now(),
+			Payload:    body,
+		}
+		if r.Header.Get("Idempotency-Key") == "" {
+			event.ID = bodyEventID(body)
+		}
+		s.dispatch(w, r, event)
+	}
+}
+
+// dispatch accepts the event and writes the response
+func (s *Server) dispatch(w http.ResponseWriter, r *http.Request, event Event) {
+	res, replayed := s.process(event, r.Header.Get("Idempotency-Key"))
+	if replayed {
+		w.Header().Set("Idempotent-Replayed", "true")
 	}
 
-	log.Printf("[WEBHOOK] Successfully sent welcome message to user %d", req.TelegramID)
+	if res.Status == http.StatusServiceUnavailable {
+		w.Header().Set("Retry-After", "1")
+	}
 
-	// Return success
 	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(map[string]interface{}{
-		"success": true,
-		"message": "Welcome message sent",
+	w.WriteHeader(res.Status)
+	json.NewEncoder(w).Encode(res.Body)
+}
+
+// process accepts the event once per idempotency key, falling back to the event ID.
+// Backend retries with the same key get the original result without a second Telegram send.
+func (s *Server) process(event Event, idempotencyKey string) (res result, replayed bool) {
+	key := idempotencyKey
+	if key == "" {
+		key = event.ID
+	}
+	if event.ID == "" {
+		event.ID = key
+	}
+	if key != "" {
+		key = event.Type + ":" + key
+	}
+
+	res, replayed = s.idempotency.Do(key, func() result {
+		return s.accept(event, key)
 	})
+	if replayed {
+		log.Printf("[WEBHOOK] Duplicate %s event %s, replaying original result", event.Type, key)
+	}
+	return res, replayed
+}
+
+// accept validates the event with its handler and hands its messages to the outbox,
+// which journals them before returning, so an accepted event survives a restart.
+// The backend gets 202 right away and can poll /webhook/events/{id} for the outcome.
+func (s *Server) accept(event Event, key string) result {
+	if event.ID == "" {
+		event.ID = newEventID()
+	}
+
+	messages, err := s.events.Prepare(event)
+	if err != nil {
+		log.Printf("[WEBHOOK] Rejected %s event %s: %v", event.Type, event.ID, err)
+		return errorResult(http.StatusBadRequest, err)
+	}
 
+	s.statuses.Set(DeliveryStatus{EventID: event.ID, Type: event.Type, State: StateQueued})
+	err = s.enqueue(event, key, messages)
+	// An overtake only starts its throttle window once it is actually on its way
+	s.overtakes.Settle(event.ID, err == nil)
+	if err != nil {
+		log.Printf("[WEBHOOK] Dropping %s event %s: %v", event.Type, event.ID, err)
+		s.statuses.Delete(event.ID)
+		return errorResult(http.StatusServiceUnavailable, err)
+	}
+
+	return result{
+		Status: http.StatusAccepted,
+		Body: map[string]interface{}{
+			"success":    true,
+			"event_id":   event.ID,
+			"state":      StateQueued,
+			"status_url": "/webhook/events/" + event.ID,
+		},
+	}
 }
 
-// handleReferral handles incoming referral notifications from the backend
-func (s *Server) handleReferral(w http.ResponseWriter, r *http.Request) {
-	// Authenticate request
-	if !s.authenticateRequest(r) {
-		log.Printf("[WEBHOOK] Unauthorized referral notification from %s", r.RemoteAddr)
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
-		return
+// enqueue puts the event's messages into the outbox. The event counts as delivered
+// once every message is sent; if any fails, the idempotency key is released so the
+// backend can retry. An error means nothing was enqueued.
+func (s *Server) enqueue(event Event, key string, messages []outbox.Message) error {
+	if len(messages) == 0 {
+		s.statuses.Set(DeliveryStatus{EventID: event.ID, Type: event.Type, State: StateSkipped})
+		return nil
 	}
 
-	// Parse request body
-	var req ReferralNotificationRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		log.Printf("[WEBHOOK] Failed to parse referral request: %v", err)
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
-		return
+	var (
+		mu        sync.Mutex
+		remaining = len(messages)
+		failure   error
+	)
+	done := func(err error) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if err != nil && failure == nil {
+			failure = err
+		}
+		if remaining--; remaining == 0 {
+			s.finish(event, key, failure)
+		}
 	}
 
-	// Validate request
-	if req.ReferrerID == 0 {
-		log.Printf("[WEBHOOK] Missing referrer_id in request")
-		http.Error(w, "referrer_id is required", http.StatusBadRequest)
-		return
+	for i, msg := range messages {
+		// Stable IDs let the outbox drop resends of an event that already went out
+		msg.ID = fmt.Sprintf("event:%s:%s:%d", event.Type, event.ID, i)
+		if err := s.outbox.Enqueue(msg, done); err != nil {
+			if i == 0 {
+				return err
+			}
+			// Part of the event is already journaled; report the rest as failed
+			for range messages[i:] {
+				done(err)
+			}
+			return nil
+		}
 	}
+	return nil
+}
 
-	log.Printf("[WEBHOOK] Received referral notification: Referrer %d, Referred %s", req.ReferrerID, req.ReferredName)
+// finish records the delivery outcome of an event
+func (s *Server) finish(event Event, key string, err error) {
+	status := DeliveryStatus{EventID: event.ID, Type: event.Type, State: StateDelivered}
+	if err != nil {
+		log.Printf("[WEBHOOK] Delivery of %s event %s failed: %v", event.Type, event.ID, err)
+		status.State = StateFailed
+		status.Error = err.Error()
+		// Let the backend retry the same event ID
+		s.idempotency.Forget(key)
+	}
+	s.statuses.Set(status)
+}
 
-	// Send notification message
-	message := fmt.Sprintf("🚀 User **%s** just joined via your invite link!\n\n💎 You received +20 Shards!", req.ReferredName)
-	recipient := &tele.User{ID: req.ReferrerID}
+// handleEventStatus reports the delivery outcome of an accepted event
+func (s *Server) handleEventStatus(w http.ResponseWriter, r *http.Request) {
+	if !s.authenticateRequest(r) {
+		log.Printf("[WEBHOOK] Unauthorized status request from %s", r.RemoteAddr)
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
 
-	if _, err := s.bot.Send(recipient, message, tele.ModeMarkdown); err != nil {
-		log.Printf("[WEBHOOK] Failed to send referral message to user %d: %v", req.ReferrerID, err)
-		// We perform a best-effort, so we don't return error to the server if the user blocked the bot
-		// But we should log it.
-	} else {
-		log.Printf("[WEBHOOK] Successfully sent referral message to user %d", req.ReferrerID)
+	status, ok := s.statuses.Get(r.PathValue("id"))
+	if !ok {
+		http.Error(w, "Unknown event", http.StatusNotFound)
+		return
 	}
 
-	// Return success
 	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(map[string]interface{}{
-		"success": true,
-		"message": "Referral notification sent",
-	})
+	json.NewEncoder(w).Encode(status)
 }
 
-// Start starts the webhook HTTP server
-func (s *Server) Start() {
-	http.HandleFunc("/webhook/new-user", s.handleNewUser)
-	http.HandleFunc("/webhook/referral", s.handleReferral)
+// newEventID generates an ID for events the backend didn't label
+func newEventID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
 
-	// Health check endpoint
-	http.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
-		w.WriteHeader(http.StatusOK)
-		w.Write([]byte("OK"))
-	})
+// bodyEventID derives an event ID from a legacy request body, which names the users
+// the notification is about
+func bodyEventID(body []byte) string {
+	sum := sha256.Sum256(body)
+	return hex.EncodeToString(sum[:16])
+}
+
+// errorResult builds a failed result
+func errorResult(status int, err error) result {
+	return result{
+		Status: status,
+		Body: map[string]interface{}{
+			"success": false,
+			"error":   err.Error(),
+		},
+	}
+}
+
+// Start starts the webhook HTTP server.
+// It refuses to start without BOT_SECRET unless unauthenticated mode is explicitly enabled,
+// since the endpoints can message arbitrary Telegram users.
+func (s *Server) Start() error {
+	if s.botSecret == "" {
+		if !s.allowUnauthenticated {
+			return errors.New("BOT_SECRET is not set; refusing to expose unauthenticated webhooks (set WEBHOOK_ALLOW_UNAUTHENTICATED=true to override)")
+		}
+		log.Println("⚠️  Webhook server running WITHOUT authentication")
+	}
 
 	addr := ":" + s.port
+	s.httpServer = &http.Server{
+		Addr:    addr,
+		Handler: s.mux,
+	}
 	log.Printf("🌐 Webhook server starting on %s", addr)
 
 	go func() {
-		if err := http.ListenAndServe(addr, nil); err != nil {
+		if err := s.httpServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
 			log.Printf("❌ Webhook server failed: %v", err)
 		}
 	}()
+
+	return nil
+}
+
+// Shutdown stops accepting requests and waits for in-flight ones until ctx expires,
+// then hands held overtake summaries to the outbox, which is closed separately.
+func (s *Server) Shutdown(ctx context.Context) error {
+	var err error
+	if s.httpServer != nil {
+		err = s.httpServer.Shutdown(ctx)
+	}
+	s.overtakes.Close()
+	return err
 }
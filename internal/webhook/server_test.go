@@ -0,0 +1,300 @@
+package webhook
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"decodeBot/internal/config"
+	"decodeBot/internal/outbox"
+	"decodeBot/internal/sender"
+
+	tele "gopkg.in/telebot.v4"
+)
+
+// countingBot records every message the server sends, optionally slowly, blocked until
+// release is closed, or failing with err
+type countingBot struct {
+	mu      sync.Mutex
+	sends   int
+	last    string            // text of the last message
+	markup  *tele.ReplyMarkup // keyboard of the last message
+	delay   time.Duration
+	release chan struct{}
+	err     error
+}
+
+func (b *countingBot) Send(to tele.Recipient, what interface{}, opts ...interface{}) (*tele.Message, error) {
+	time.Sleep(b.delay)
+	if b.release != nil {
+		<-b.release
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.err != nil {
+		return nil, b.err
+	}
+	b.sends++
+	b.last, _ = what.(string)
+	b.markup = nil
+	for _, opt := range opts {
+		if markup, ok := opt.(*tele.ReplyMarkup); ok {
+			b.markup = markup
+		}
+	}
+	return &tele.Message{}, nil
+}
+
+func (b *countingBot) setErr(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.err = err
+}
+
+func (b *countingBot) count() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.sends
+}
+
+func newTestServer(t *testing.T, bot sender.Bot) *Server {
+	t.Helper()
+
+	cfg := &config.Config{
+		BotSecret:             "test-secret",
+		WebhookMaxSkew:        5 * time.Minute,
+		WebhookIdempotencyTTL: time.Hour,
+		LeaderboardThrottle:   time.Hour,
+		WebhookBatchMaxEvents: 3,
+	}
+
+	msgSender := sender.New(bot, sender.Options{GlobalRate: 1000, PerChatRate: 1000})
+	out, err := outbox.Open(filepath.Join(t.TempDir(), "outbox.jsonl"), msgSender, outbox.Options{QueueSize: 10, Workers: 2})
+	if err != nil {
+		t.Fatalf("Failed to open outbox: %v", err)
+	}
+	t.Cleanup(func() {
+		out.Close(context.Background())
+	})
+	return NewServer(out, cfg)
+}
+
+// post sends a freshly signed request, like a backend retry would
+func post(s *Server, path, body string, headers map[string]string) *httptest.ResponseRecorder {
+	return postAt(s, time.Now(), path, body, headers)
+}
+
+// postAt sends a request signed with the given timestamp
+func postAt(s *Server, at time.Time, path, body string, headers map[string]string) *httptest.ResponseRecorder {
+	r := signedRequest("test-secret", at.Unix(), body)
+	r.URL.Path = path
+	for k, v := range headers {
+		r.Header.Set(k, v)
+	}
+	w := httptest.NewRecorder()
+	s.mux.ServeHTTP(w, r)
+	return w
+}
+
+// waitForState polls the delivery status until it reaches state
+func waitForState(t *testing.T, s *Server, eventID, state string) DeliveryStatus {
+	t.Helper()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if status, ok := s.statuses.Get(eventID); ok && status.State == state {
+			return status
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("Event %s never reached state %s", eventID, state)
+	return DeliveryStatus{}
+}
+
+// drain waits for all queued messages to be sent
+func drain(t *testing.T, s *Server) {
+	t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := s.outbox.Close(ctx); err != nil {
+		t.Fatalf("Outbox didn't drain: %v", err)
+	}
+}
+
+func TestEventRetryStormSendsOnce(t *testing.T) {
+	bot := &countingBot{delay: 50 * time.Millisecond}
+	s := newTestServer(t, bot)
+
+	body := `{"type":"new_user","id":"evt_1","payload":{"telegram_id":123,"first_name":"Neo"}}`
+
+	// The backend times out and fires a burst of retries, each signed a second apart...
+	var wg sync.WaitGroup
+	codes := make([]int, 20)
+	for i := range codes {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			at := time.Now().Add(-time.Duration(i) * time.Second)
+			codes[i] = postAt(s, at, "/webhook/events", body, nil).Code
+		}(i)
+	}
+	wg.Wait()
+
+	for i, code := range codes {
+		if code != http.StatusAccepted {
+			t.Errorf("Expected 202 for delivery %d, got %d", i, code)
+		}
+	}
+
+	waitForState(t, s, "evt_1", StateDelivered)
+
+	// ...and one more later on
+	w := postAt(s, time.Now().Add(time.Minute), "/webhook/events", body, nil)
+	if w.Code != http.StatusAccepted || w.Header().Get("Idempotent-Replayed") != "true" {
+		t.Errorf("Expected late retry to be replayed with 202, got %d", w.Code)
+	}
+
+	drain(t, s)
+	if got := bot.count(); got != 1 {
+		t.Errorf("Expected exactly 1 Telegram send, got %d", got)
+	}
+}
+
+func TestLegacyRouteIdempotencyKey(t *testing.T) {
+	bot := &countingBot{}
+	s := newTestServer(t, bot)
+
+	body := `{"telegram_id":123,"first_name":"Neo"}`
+	headers := map[string]string{"Idempotency-Key": "signup-123"}
+
+	for i := 0; i < 3; i++ {
+		at := time.Now().Add(time.Duration(i) * time.Second)
+		if w := postAt(s, at, "/webhook/new-user", body, headers); w.Code != http.StatusAccepted {
+			t.Fatalf("Expected 202, got %d: %s", w.Code, w.Body)
+		}
+	}
+
+	waitForState(t, s, "signup-123", StateDelivered)
+	if got := bot.count(); got != 1 {
+		t.Errorf("Expected exactly 1 Telegram send, got %d", got)
+	}
+
+	// Without a key, retries of the same body are recognized too
+	other := `{"telegram_id":456,"first_name":"Trinity"}`
+	var wg sync.WaitGroup
+	codes := make([]int, 10)
+	for i := range codes {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			at := time.Now().Add(time.Duration(10+i) * time.Second)
+			codes[i] = postAt(s, at, "/webhook/new-user", other, nil).Code
+		}(i)
+	}
+	wg.Wait()
+
+	for i, code := range codes {
+		if code != http.StatusAccepted {
+			t.Errorf("Expected 202 for unkeyed delivery %d, got %d", i, code)
+		}
+	}
+	waitForState(t, s, bodyEventID([]byte(other)), StateDelivered)
+	drain(t, s)
+	if got := bot.count(); got != 2 {
+		t.Errorf("Expected one send per user, got %d sends", got)
+	}
+}
+
+func TestFailedDeliveryIsNotCached(t *testing.T) {
+	bot := &countingBot{err: errors.New("telegram is down")}
+	s := newTestServer(t, bot)
+
+	body := `{"type":"new_user","id":"evt_2","payload":{"telegram_id":123}}`
+	post(s, "/webhook/events", body, nil)
+	status := waitForState(t, s, "evt_2", StateFailed)
+	if status.Error != "telegram is down" {
+		t.Errorf("Expected failure reason in status, got %q", status.Error)
+	}
+
+	bot.setErr(nil)
+	if w := postAt(s, time.Now().Add(time.Second), "/webhook/events", body, nil); w.Header().Get("Idempotent-Replayed") == "true" {
+		t.Errorf("Expected retry after failure to be accepted as new")
+	}
+	waitForState(t, s, "evt_2", StateDelivered)
+
+	if got := bot.count(); got != 1 {
+		t.Errorf("Expected the retry to send, got %d sends", got)
+	}
+}
+
+func TestUnknownEventType(t *testing.T) {
+	s := newTestServer(t, &countingBot{})
+
+	w := post(s, "/webhook/events", `{"type":"nope","id":"evt_3","payload":{}}`, nil)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for unknown type, got %d", w.Code)
+	}
+	if !strings.Contains(w.Body.String(), "unknown event type") {
+		t.Errorf("Expected unknown event type error, got %s", w.Body)
+	}
+}
+
+func TestFullQueueAppliesBackpressure(t *testing.T) {
+	bot := &countingBot{release: make(chan struct{})}
+	s := newTestServer(t, bot)
+
+	// 2 workers busy + 10 queued, the rest must be refused
+	refused := 0
+	for i := 0; i < 20; i++ {
+		body := fmt.Sprintf(`{"type":"new_user","id":"evt_%d","payload":{"telegram_id":%d}}`, i, 100+i)
+		w := post(s, "/webhook/events", body, nil)
+		if w.Code == http.StatusServiceUnavailable {
+			refused++
+			if w.Header().Get("Retry-After") == "" {
+				t.Errorf("Expected Retry-After on 503")
+			}
+		}
+	}
+
+	if refused == 0 {
+		t.Errorf("Expected some events to be refused when the queue is full")
+	}
+
+	close(bot.release)
+	drain(t, s)
+}
+
+func TestEventStatusEndpoint(t *testing.T) {
+	s := newTestServer(t, &countingBot{})
+
+	post(s, "/webhook/events", `{"type":"new_user","id":"evt_4","payload":{"telegram_id":123}}`, nil)
+	waitForState(t, s, "evt_4", StateDelivered)
+
+	r := signedRequest("test-secret", time.Now().Unix(), "")
+	r.Method = "GET"
+	r.URL.Path = "/webhook/events/evt_4"
+	w := httptest.NewRecorder()
+	s.mux.ServeHTTP(w, r)
+
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"state":"delivered"`) {
+		t.Errorf("Expected delivered status, got %d: %s", w.Code, w.Body)
+	}
+}
+
+func TestFailedReferralIsReported(t *testing.T) {
+	s := newTestServer(t, &countingBot{err: tele.ErrBlockedByUser})
+
+	post(s, "/webhook/events", `{"type":"referral","id":"evt_5","payload":{"referrer_id":42,"referred_name":"Neo"}}`, nil)
+	status := waitForState(t, s, "evt_5", StateFailed)
+	if !strings.Contains(status.Error, "blocked") {
+		t.Errorf("Expected the Telegram error in status, got %q", status.Error)
+	}
+}
@@ -0,0 +1,94 @@
+package webhook
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// Delivery states reported by the status endpoint
+const (
+	StateQueued    = "queued"
+	StateDelivered = "delivered"
+	StateFailed    = "failed"
+	StateSkipped   = "skipped" // nothing to send, or collapsed into a later summary
+)
+
+const (
+	// statusTTL is how long delivery outcomes stay queryable
+	statusTTL = time.Hour
+	// statusMaxEntries bounds the number of remembered delivery outcomes
+	statusMaxEntries = 10000
+)
+
+// DeliveryStatus is the outcome of an accepted event
+type DeliveryStatus struct {
+	EventID   string    `json:"event_id"`
+	Type      string    `json:"type"`
+	State     string    `json:"state"`
+	Error     string    `json:"error,omitempty"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// statusStore keeps delivery statuses for a bounded time and size
+type statusStore struct {
+	mu         sync.Mutex
+	ttl        time.Duration
+	maxEntries int
+	entries    map[string]*list.Element
+	order      *list.List // least recently updated first
+}
+
+func newStatusStore(ttl time.Duration, maxEntries int) *statusStore {
+	return &statusStore{
+		ttl:        ttl,
+		maxEntries: maxEntries,
+		entries:    make(map[string]*list.Element),
+		order:      list.New(),
+	}
+}
+
+// Set records a status, stamping its update time
+func (s *statusStore) Set(status DeliveryStatus) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	status.UpdatedAt = time.Now()
+	if el, ok := s.entries[status.EventID]; ok {
+		s.order.Remove(el)
+	}
+	s.entries[status.EventID] = s.order.PushBack(status)
+
+	cutoff := status.UpdatedAt.Add(-s.ttl)
+	for el := s.order.Front(); el != nil; el = s.order.Front() {
+		oldest := el.Value.(DeliveryStatus)
+		if s.order.Len() <= s.maxEntries && oldest.UpdatedAt.After(cutoff) {
+			break
+		}
+		s.order.Remove(el)
+		delete(s.entries, oldest.EventID)
+	}
+}
+
+// Get returns the status for an event ID
+func (s *statusStore) Get(eventID string) (DeliveryStatus, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	el, ok := s.entries[eventID]
+	if !ok {
+		return DeliveryStatus{}, false
+	}
+	return el.Value.(DeliveryStatus), true
+}
+
+// Delete forgets an event ID
+func (s *statusStore) Delete(eventID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if el, ok := s.entries[eventID]; ok {
+		s.order.Remove(el)
+		delete(s.entries, eventID)
+	}
+}
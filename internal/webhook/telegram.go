@@ -0,0 +1,44 @@
+package webhook
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"log"
+	"net/http"
+
+	tele "gopkg.in/telebot.v4"
+)
+
+// TelegramHandler receives updates pushed by Telegram in webhook mode and feeds
+// them to the bot's update channel. Requests must carry the secret token that was
+// registered with setWebhook in the X-Telegram-Bot-Api-Secret-Token header.
+func TelegramHandler(updates chan<- tele.Update, secretToken string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		provided := r.Header.Get("X-Telegram-Bot-Api-Secret-Token")
+		if subtle.ConstantTimeCompare([]byte(provided), []byte(secretToken)) != 1 {
+			log.Printf("[TELEGRAM] Rejected update with invalid secret token from %s", r.RemoteAddr)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		var update tele.Update
+		if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+			log.Printf("[TELEGRAM] Failed to decode update: %v", err)
+			http.Error(w, "Invalid update", http.StatusBadRequest)
+			return
+		}
+
+		// Blocks while the bot is busy so Telegram retries instead of us dropping updates
+		select {
+		case updates <- update:
+			w.WriteHeader(http.StatusOK)
+		case <-r.Context().Done():
+			http.Error(w, "Timeout", http.StatusServiceUnavailable)
+		}
+	})
+}
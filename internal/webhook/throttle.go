@@ -0,0 +1,154 @@
+package webhook
+
+import (
+	"sync"
+	"time"
+
+	"decodeBot/internal/bot"
+)
+
+// overtakeRecipient is what the summary needs to address the overtaken user
+type overtakeRecipient struct {
+	FirstName    string
+	LanguageCode string
+}
+
+// overtakeFlush sends the overtakes collected for a recipient during a throttle window
+type overtakeFlush func(chatID int64, to overtakeRecipient, overtakes []bot.Overtake)
+
+// overtakeThrottle lets through at most one overtake notification per recipient per window.
+// Overtakes arriving inside a window are collected and flushed as one summary when it ends,
+// which opens a new window.
+//
+// Pending summaries live in memory only: Close sends them on a clean shutdown, but a crash
+// loses the overtakes collected since the recipient's last notification.
+type overtakeThrottle struct {
+	mu         sync.Mutex
+	window     time.Duration
+	flush      overtakeFlush
+	recipients map[int64]*throttleWindow
+	reserved   map[string]int64 // event ID -> recipient, for windows waiting on Settle
+	closed     bool
+}
+
+// throttleWindow is the window of a single recipient. Its timer is nil while the
+// notification that opens it hasn't been accepted by the outbox yet.
+type throttleWindow struct {
+	timer   *time.Timer
+	to      overtakeRecipient
+	pending []bot.Overtake
+}
+
+// newOvertakeThrottle creates a throttle that hands collected overtakes to flush
+func newOvertakeThrottle(window time.Duration, flush overtakeFlush) *overtakeThrottle {
+	return &overtakeThrottle{
+		window:     window,
+		flush:      flush,
+		recipients: make(map[int64]*throttleWindow),
+		reserved:   make(map[string]int64),
+	}
+}
+
+// Allow reports whether an overtake may be sent to chatID right away, reserving the
+// recipient's window for eventID until Settle reports whether the send was enqueued.
+// Otherwise the overtake is held for the summary at the end of the recipient's window.
+func (t *overtakeThrottle) Allow(chatID int64, to overtakeRecipient, o bot.Overtake, eventID string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.closed {
+		return true
+	}
+
+	w, ok := t.recipients[chatID]
+	if !ok {
+		t.recipients[chatID] = &throttleWindow{to: to}
+		t.reserved[eventID] = chatID
+		return true
+	}
+
+	// Keep the latest details in case the user renamed or switched language
+	if to.FirstName != "" {
+		w.to.FirstName = to.FirstName
+	}
+	if to.LanguageCode != "" {
+		w.to.LanguageCode = to.LanguageCode
+	}
+	w.pending = append(w.pending, o)
+	return false
+}
+
+// Settle opens the window reserved by eventID once its notification is enqueued. If it
+// couldn't be, the window is given up so the backend's retry is sent right away, and
+// overtakes held in the meantime go out as a summary instead. Other events are ignored.
+func (t *overtakeThrottle) Settle(eventID string, enqueued bool) {
+	t.mu.Lock()
+	chatID, ok := t.reserved[eventID]
+	if !ok {
+		t.mu.Unlock()
+		return
+	}
+	delete(t.reserved, eventID)
+
+	w, ok := t.recipients[chatID]
+	if !ok {
+		// Close already took the window
+		t.mu.Unlock()
+		return
+	}
+	if enqueued {
+		w.timer = t.startWindow(chatID)
+		t.mu.Unlock()
+		return
+	}
+	t.mu.Unlock()
+
+	t.expire(chatID)
+}
+
+// startWindow schedules the end of a recipient's window. Must be called with mu held.
+func (t *overtakeThrottle) startWindow(chatID int64) *time.Timer {
+	return time.AfterFunc(t.window, func() { t.expire(chatID) })
+}
+
+// expire ends a recipient's window, flushing anything collected during it
+func (t *overtakeThrottle) expire(chatID int64) {
+	t.mu.Lock()
+	w, ok := t.recipients[chatID]
+	if !ok {
+		t.mu.Unlock()
+		return
+	}
+	if len(w.pending) == 0 {
+		delete(t.recipients, chatID)
+		t.mu.Unlock()
+		return
+	}
+
+	to, pending := w.to, w.pending
+	w.pending = nil
+	// The summary counts as this window's notification
+	w.timer = t.startWindow(chatID)
+	t.mu.Unlock()
+
+	t.flush(chatID, to, pending)
+}
+
+// Close stops all windows and flushes pending overtakes right away
+func (t *overtakeThrottle) Close() {
+	t.mu.Lock()
+	t.closed = true
+	recipients := t.recipients
+	t.recipients = make(map[int64]*throttleWindow)
+	t.reserved = make(map[string]int64)
+	t.mu.Unlock()
+
+	for chatID, w := range recipients {
+		if w.timer != nil {
+			w.timer.Stop()
+		}
+		if len(w.pending) > 0 {
+			t.flush(chatID, w.to, w.pending)
+		}
+	}
+}